@@ -0,0 +1,120 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// 存储后端类型
+const (
+	BackendTypeOBS   = "obs"
+	BackendTypeS3    = "s3"
+	BackendTypeLocal = "local"
+)
+
+// Backend 对象存储后端
+// Uploader、Downloader、Lister 只通过该接口访问存储服务，华为云 OBS 是其中一种实现
+// 服务端返回的错误应为 *Error，以便调用方使用 errors.Is 判断 ErrNotFound 等错误
+type Backend interface {
+	// PutObject 上传对象，size 为 -1 表示长度未知，opts 可以为 nil
+	PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error
+	// GetObject 下载对象，opts 为 nil 时下载整个对象
+	GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error)
+	// HeadObject 获取对象元信息
+	HeadObject(ctx context.Context, key string) (*Entry, error)
+	// ListObjects 列举对象，nextMarker 为空表示已经列举完毕
+	ListObjects(ctx context.Context, prefix, delimiter, marker string, limit int) (entries []ListItem, commonPrefixes []string, nextMarker string, err error)
+	// DeleteObject 删除对象
+	DeleteObject(ctx context.Context, key string) error
+	// DeleteObjects 批量删除对象，只返回删除失败的对象
+	DeleteObjects(ctx context.Context, keys []string) ([]*DeleteKeysError, error)
+
+	// InitiateMultipartUpload 初始化分片上传，返回 uploadID，opts 中的元数据在合并分片后生效
+	InitiateMultipartUpload(ctx context.Context, key string, opts *PutOptions) (uploadID string, err error)
+	// UploadPart 上传分片，partNumber 从 1 开始，返回分片的 ETag，opts 中只使用 ContentMD5
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (etag string, err error)
+	// CompleteMultipartUpload 合并分片，parts 需按 PartNumber 升序排列
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipartUpload 取消分片上传
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// MultipartLister 列举未完成的分片上传，Backend 可选实现
+// 用于在断点丢失后从服务端恢复已上传的分片，以及清理过期的分片上传
+type MultipartLister interface {
+	// ListMultipartUploads 列举以 prefix 开头的对象上未完成的分片上传
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error)
+	// ListParts 列举分片上传中已上传的分片，按 PartNumber 升序排列
+	ListParts(ctx context.Context, key, uploadID string) ([]Part, error)
+}
+
+// MultipartUpload 未完成的分片上传
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// Range 下载范围
+// Offset 为 -1 时表示下载最后 Size 个字节，Size 为 -1 时表示从 Offset 下载到结尾
+type Range struct {
+	Offset int64
+	Size   int64
+}
+
+func (r *Range) String() string {
+	return generateRange(r.Offset, r.Size)
+}
+
+// PutOptions 上传对象或分片的可选参数
+type PutOptions struct {
+	// ContentMD5 base64 编码的数据 MD5，服务端收到的数据与之不同时返回 400 BadDigest
+	ContentMD5 string
+	// Metadata 自定义元数据，下载时在 Entry.Metadata 中返回
+	Metadata map[string]string
+}
+
+// GetOptions 下载对象的可选参数
+type GetOptions struct {
+	// Range 下载范围，为 nil 时下载整个对象
+	Range *Range
+	// IfMatch 不为空时只在对象的 ETag 与之相同时下载，否则返回 ErrPreconditionFailed
+	IfMatch string
+}
+
+// GetObjectOutput 下载对象的结果
+type GetObjectOutput struct {
+	Body io.ReadCloser
+	// ContentLength 是 Body 的长度，指定 Range 时与 Entry.Fsize 不同
+	ContentLength int64
+	// Entry 对象元信息，Fsize 为对象的总长度
+	Entry
+}
+
+// Part 已上传的分片
+type Part struct {
+	PartNumber int
+	ETag       string
+	Size       int64
+}
+
+// 创建配置对应的存储后端
+func newBackend(c *Config) (Backend, error) {
+	if c.Backend != nil {
+		return c.Backend, nil
+	}
+
+	switch c.Type {
+	case "", BackendTypeOBS:
+		return NewOBSBackend(c)
+	case BackendTypeS3:
+		return NewS3Backend(c)
+	case BackendTypeLocal:
+		return NewLocalBackend(filepath.Join(c.LocalRoot, c.Bucket))
+	default:
+		return nil, fmt.Errorf("unknown backend type %q", c.Type)
+	}
+}
@@ -0,0 +1,577 @@
+package operation
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 本地存储后端在根目录下保留的目录，存放临时文件和未完成的分片上传
+	localReservedDir = ".obs-uploads"
+	// 保存自定义元数据的目录，对象 key 对应其中的 <key>.json 文件
+	localMetaDir = ".obs-meta"
+)
+
+// LocalBackend 本地文件系统存储后端
+// 对象 key 以 / 分隔映射为根目录下的文件路径，ETag 为文件内容的 MD5，LastModified 为文件的修改时间，
+// 自定义元数据（包括 Config.Checksum 写入的校验和）保存在 .obs-meta 目录下的 JSON 文件中，
+// 其中记录了写入时的 ETag，文件内容在后端之外被修改后元数据失效，下载时按 ETag 校验整个文件
+//
+// 受文件系统的限制：
+//   - 以 / 结尾、包含空路径段或 . / .. 的 key 返回 400 InvalidObjectName
+//   - a 与 a/b 这样一个 key 是另一个 key 目录前缀的对象不能同时存在，后写入的返回错误
+//   - ListObjects 每次分页都会遍历前缀所在目录下的整个子树，对象很多时开销较大
+type LocalBackend struct {
+	root string
+
+	mu    sync.Mutex
+	etags map[string]localETag
+}
+
+// 缓存的 ETag，文件大小或修改时间变化后失效
+type localETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// NewLocalBackend 创建以 root 为根目录的本地存储后端，目录不存在时会自动创建
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Join(root, localReservedDir), 0755); err != nil {
+		return nil, err
+	}
+	return &LocalBackend{root: root, etags: make(map[string]localETag)}, nil
+}
+
+// 将对象 key 转换为文件路径，拒绝会逃逸出根目录或与保留目录冲突的 key
+func (b *LocalBackend) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if key == "" || cleaned != key || isLocalReserved(cleaned) {
+		return "", newObsError(http.StatusBadRequest, "InvalidObjectName", fmt.Sprintf("invalid object name %q for local backend", key))
+	}
+	return filepath.Join(b.root, filepath.FromSlash(key)), nil
+}
+
+func isLocalReserved(key string) bool {
+	for _, dir := range []string{localReservedDir, localMetaDir} {
+		if key == dir || strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// 对象元数据文件的路径，调用前 key 已经过 path 校验
+func (b *LocalBackend) metaPath(key string) string {
+	return filepath.Join(b.root, localMetaDir, filepath.FromSlash(key)+".json")
+}
+
+// 元数据文件的内容，ETag 与对象当前的 ETag 不同时说明文件已在后端之外被修改
+type localMetadata struct {
+	ETag     string            `json:"etag"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// 写入数据的同时计算 MD5，先写入保留目录中的临时文件，再写入元数据文件，最后重命名到目标路径，避免读到写了一半的文件
+func (b *LocalBackend) writeFile(key string, opts *PutOptions, write func(w io.Writer) error) error {
+	name, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Join(b.root, localReservedDir), "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	h := md5.New()
+	if err = write(io.MultiWriter(f, h)); err != nil {
+		f.Close()
+		return err
+	}
+	if err = checkContentMD5(opts, h.Sum(nil)); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+	var metadata map[string]string
+	if opts != nil {
+		metadata = opts.Metadata
+	}
+	if err = b.writeMetadata(key, etag, metadata); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	if info, err := os.Stat(name); err == nil {
+		b.mu.Lock()
+		b.etags[name] = localETag{size: info.Size(), modTime: info.ModTime(), etag: etag}
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// 写入对象的元数据文件，没有元数据时删除旧的元数据文件
+func (b *LocalBackend) writeMetadata(key, etag string, metadata map[string]string) error {
+	name := b.metaPath(key)
+	if len(metadata) == 0 {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(localMetadata{ETag: etag, Metadata: metadata})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Join(b.root, localReservedDir), "meta-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// 读取对象的元数据，元数据文件不存在、损坏或与 ETag 不匹配时返回 nil
+func (b *LocalBackend) readMetadata(key, etag string) map[string]string {
+	data, err := os.ReadFile(b.metaPath(key))
+	if err != nil {
+		return nil
+	}
+	var m localMetadata
+	if json.Unmarshal(data, &m) != nil || m.ETag != etag {
+		return nil
+	}
+	return m.Metadata
+}
+
+func (b *LocalBackend) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	return b.writeFile(key, opts, func(w io.Writer) error {
+		n, err := io.Copy(w, body)
+		if err != nil {
+			return err
+		}
+		if size >= 0 && n != size {
+			return newObsError(http.StatusBadRequest, "IncompleteBody", "body length does not match content length")
+		}
+		return nil
+	})
+}
+
+func (b *LocalBackend) stat(key string) (string, os.FileInfo, error) {
+	name, err := b.path(key)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(name)
+	if err != nil || info.IsDir() {
+		return "", nil, newObsError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+	}
+	return name, info, nil
+}
+
+func (b *LocalBackend) entry(name, key string, info os.FileInfo) (*Entry, error) {
+	etag, err := b.etag(name, info)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Hash:     etag,
+		Fsize:    info.Size(),
+		PutTime:  info.ModTime(),
+		MimeType: mime.TypeByExtension(path.Ext(key)),
+		Metadata: b.readMetadata(key, etag),
+	}, nil
+}
+
+// 计算文件的 ETag，文件未变化时使用缓存
+func (b *LocalBackend) etag(name string, info os.FileInfo) (string, error) {
+	b.mu.Lock()
+	cached, ok := b.etags[name]
+	b.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag, nil
+	}
+
+	etag, err := fileETag(name)
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	b.etags[name] = localETag{size: info.Size(), modTime: info.ModTime(), etag: etag}
+	b.mu.Unlock()
+	return etag, nil
+}
+
+// 文件内容 MD5 形式的 ETag
+func fileETag(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`, nil
+}
+
+func (b *LocalBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	name, info, err := b.stat(key)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := b.entry(name, key, info)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkIfMatch(opts, entry.Hash); err != nil {
+		return nil, err
+	}
+
+	start, end := int64(0), info.Size()
+	if opts != nil && opts.Range != nil {
+		var ok bool
+		if start, end, ok = resolveRange(opts.Range, info.Size()); !ok {
+			return nil, newObsError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range cannot be satisfied.")
+		}
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &GetObjectOutput{
+		Body: struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(f, start, end-start), f},
+		ContentLength: end - start,
+		Entry:         *entry,
+	}, nil
+}
+
+func (b *LocalBackend) HeadObject(ctx context.Context, key string) (*Entry, error) {
+	name, info, err := b.stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.entry(name, key, info)
+}
+
+func (b *LocalBackend) ListObjects(ctx context.Context, prefix, delimiter, marker string, limit int) ([]ListItem, []string, string, error) {
+	// 从前缀中最深的目录开始遍历
+	dir := b.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = filepath.Join(b.root, filepath.FromSlash(prefix[:i]))
+	}
+	if rel, err := filepath.Rel(b.root, dir); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, nil, "", nil
+	}
+
+	var keys []string
+	infos := make(map[string]os.FileInfo)
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(b.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if info.IsDir() {
+			if isLocalReserved(key) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+			infos[key] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	keys, commonPrefixes, nextMarker := paginateKeys(keys, prefix, delimiter, marker, limit)
+	entries := make([]ListItem, 0, len(keys))
+	for _, key := range keys {
+		info := infos[key]
+		etag, err := b.etag(filepath.Join(b.root, filepath.FromSlash(key)), info)
+		if err != nil {
+			// 列举过程中被删除
+			continue
+		}
+		entries = append(entries, ListItem{
+			Key:     key,
+			Hash:    etag,
+			Fsize:   info.Size(),
+			PutTime: info.ModTime(),
+		})
+	}
+	return entries, commonPrefixes, nextMarker, nil
+}
+
+func (b *LocalBackend) DeleteObject(ctx context.Context, key string) error {
+	name, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = os.Remove(b.metaPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	b.mu.Lock()
+	delete(b.etags, name)
+	b.mu.Unlock()
+	b.removeEmptyDirs(filepath.Dir(name))
+	b.removeEmptyDirs(filepath.Dir(b.metaPath(key)))
+	return nil
+}
+
+// 删除对象后清理空的父目录，直到根目录为止
+func (b *LocalBackend) removeEmptyDirs(dir string) {
+	for dir != b.root && strings.HasPrefix(dir, b.root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (b *LocalBackend) DeleteObjects(ctx context.Context, keys []string) ([]*DeleteKeysError, error) {
+	var errs []*DeleteKeysError
+	for _, key := range keys {
+		if err := b.DeleteObject(ctx, key); err != nil {
+			errs = append(errs, &DeleteKeysError{Name: key, Code: "InternalError", Message: err.Error()})
+		}
+	}
+	return errs, nil
+}
+
+func (b *LocalBackend) uploadDir(uploadID string) string {
+	return filepath.Join(b.root, localReservedDir, uploadID)
+}
+
+func (b *LocalBackend) checkUpload(key, uploadID string) error {
+	if strings.ContainsAny(uploadID, `/\.`) {
+		return newObsError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	}
+	data, err := os.ReadFile(filepath.Join(b.uploadDir(uploadID), "key"))
+	if err != nil || string(data) != key {
+		return newObsError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	}
+	return nil
+}
+
+func (b *LocalBackend) InitiateMultipartUpload(ctx context.Context, key string, opts *PutOptions) (string, error) {
+	if _, err := b.path(key); err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Join(b.root, localReservedDir), "upload-")
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filepath.Join(dir, "key"), []byte(key), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	// 元数据在初始化时指定，完成上传时写入
+	if opts != nil && len(opts.Metadata) > 0 {
+		data, err := json.Marshal(opts.Metadata)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, "metadata"), data, 0644)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return filepath.Base(dir), nil
+}
+
+func (b *LocalBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (string, error) {
+	if err := b.checkUpload(key, uploadID); err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp(b.uploadDir(uploadID), "part-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && n != size {
+		return "", newObsError(http.StatusBadRequest, "IncompleteBody", "body length does not match content length")
+	}
+	if err = checkContentMD5(opts, h.Sum(nil)); err != nil {
+		return "", err
+	}
+	if err = os.Rename(f.Name(), filepath.Join(b.uploadDir(uploadID), strconv.Itoa(partNumber))); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`, nil
+}
+
+func (b *LocalBackend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	if err := b.checkUpload(key, uploadID); err != nil {
+		return err
+	}
+	opts := &PutOptions{}
+	if data, err := os.ReadFile(filepath.Join(b.uploadDir(uploadID), "metadata")); err == nil {
+		if err = json.Unmarshal(data, &opts.Metadata); err != nil {
+			return err
+		}
+	}
+
+	err := b.writeFile(key, opts, func(w io.Writer) error {
+		for i, part := range parts {
+			if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+				return newObsError(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+			}
+			partFile, err := os.Open(filepath.Join(b.uploadDir(uploadID), strconv.Itoa(part.PartNumber)))
+			if err != nil {
+				return newObsError(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+			}
+			_, err = io.Copy(w, partFile)
+			partFile.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(b.uploadDir(uploadID))
+}
+
+func (b *LocalBackend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	if err := b.checkUpload(key, uploadID); err != nil {
+		return err
+	}
+	return os.RemoveAll(b.uploadDir(uploadID))
+}
+
+// ListMultipartUploads 列举保留目录中的分片上传，Initiated 为初始化时写入 key 文件的时间
+func (b *LocalBackend) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	dirs, err := os.ReadDir(filepath.Join(b.root, localReservedDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var uploads []MultipartUpload
+	for _, dir := range dirs {
+		if !dir.IsDir() || !strings.HasPrefix(dir.Name(), "upload-") {
+			continue
+		}
+		name := filepath.Join(b.uploadDir(dir.Name()), "key")
+		key, err := os.ReadFile(name)
+		if err != nil || !strings.HasPrefix(string(key), prefix) {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		uploads = append(uploads, MultipartUpload{Key: string(key), UploadID: dir.Name(), Initiated: info.ModTime()})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	return uploads, nil
+}
+
+func (b *LocalBackend) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	if err := b.checkUpload(key, uploadID); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(b.uploadDir(uploadID))
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []Part
+	for _, file := range files {
+		partNumber, err := strconv.Atoi(file.Name())
+		if err != nil {
+			continue
+		}
+		name := filepath.Join(b.uploadDir(uploadID), file.Name())
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		etag, err := fileETag(name)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, Part{PartNumber: partNumber, ETag: etag, Size: info.Size()})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
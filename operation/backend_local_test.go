@@ -0,0 +1,203 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBackend_Object(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	b, err := NewLocalBackend(root)
+	assert.NoError(t, err)
+
+	err = b.PutObject(ctx, "dir/sub/file.txt", bytes.NewReader([]byte("0123456789")), 10, nil)
+	assert.NoError(t, err)
+
+	// key 映射为根目录下的文件
+	data, err := os.ReadFile(filepath.Join(root, "dir", "sub", "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	entry, err := b.HeadObject(ctx, "dir/sub/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, `"781e5e245d69b566979b86e28d23f2c7"`, entry.Hash)
+	assert.Equal(t, int64(10), entry.Fsize)
+	assert.Equal(t, "text/plain; charset=utf-8", entry.MimeType)
+
+	output, err := b.GetObject(ctx, "dir/sub/file.txt", &GetOptions{Range: &Range{Offset: 3, Size: 4}})
+	assert.NoError(t, err)
+	data, err = io.ReadAll(output.Body)
+	output.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "3456", string(data))
+	assert.Equal(t, int64(4), output.ContentLength)
+
+	_, err = b.GetObject(ctx, "dir/sub/file.txt", &GetOptions{Range: &Range{Offset: 10, Size: 1}})
+	assert.Equal(t, 416, statusCodeOf(err))
+
+	// 删除后清理空目录
+	err = b.DeleteObject(ctx, "dir/sub/file.txt")
+	assert.NoError(t, err)
+	_, err = b.HeadObject(ctx, "dir/sub/file.txt")
+	assert.Equal(t, 404, statusCodeOf(err))
+	_, err = os.Stat(filepath.Join(root, "dir"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 非法 key
+	for _, key := range []string{"", "../escape", "a//b", "/abs", "dir/", localReservedDir + "/x", localMetaDir + "/x"} {
+		err = b.PutObject(ctx, key, bytes.NewReader(nil), 0, nil)
+		assert.Equal(t, 400, statusCodeOf(err), key)
+	}
+
+	// a 与 a/b 不能同时存在
+	assert.NoError(t, b.PutObject(ctx, "a", bytes.NewReader(nil), 0, nil))
+	assert.Error(t, b.PutObject(ctx, "a/b", bytes.NewReader(nil), 0, nil))
+}
+
+func TestLocalBackend_ListObjects(t *testing.T) {
+	ctx := context.Background()
+	b, err := NewLocalBackend(t.TempDir())
+	assert.NoError(t, err)
+
+	keys := []string{"a-c", "a/b", "a/c/d", "b"}
+	for _, key := range keys {
+		err := b.PutObject(ctx, key, bytes.NewReader([]byte(key)), int64(len(key)), nil)
+		assert.NoError(t, err)
+	}
+	// 未完成的分片上传不会被列举出来
+	_, err = b.InitiateMultipartUpload(ctx, "pending", nil)
+	assert.NoError(t, err)
+
+	var (
+		listed []string
+		marker string
+	)
+	for {
+		entries, _, nextMarker, err := b.ListObjects(ctx, "", "", marker, 3)
+		assert.NoError(t, err)
+		for _, entry := range entries {
+			listed = append(listed, entry.Key)
+		}
+		if nextMarker == "" {
+			break
+		}
+		marker = nextMarker
+	}
+	assert.Equal(t, keys, listed)
+
+	entries, commonPrefixes, _, err := b.ListObjects(ctx, "a/", "/", "", 1000)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "a/b", entries[0].Key)
+	assert.Equal(t, []string{"a/c/"}, commonPrefixes)
+}
+
+func TestLocalBackend_Operation(t *testing.T) {
+	config := &Config{
+		Type:      BackendTypeLocal,
+		LocalRoot: t.TempDir(),
+		Bucket:    "bucket",
+	}
+
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	err = uploader.UploadData([]byte("test1"), "test1")
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "upload")
+	err = os.WriteFile(file, []byte("test2"), 0644)
+	assert.NoError(t, err)
+	err = uploader.Upload(file, "test2")
+	assert.NoError(t, err)
+
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	data, err := downloader.DownloadBytes("test2")
+	assert.NoError(t, err)
+	assert.Equal(t, "test2", string(data))
+
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test1", "test2"}, mustListPrefix(t, lister, ""))
+
+	backend, err := NewLocalBackend(filepath.Join(config.LocalRoot, config.Bucket))
+	assert.NoError(t, err)
+	err = uploadSmallParts(t, backend, []byte("multipart"), "test3")
+	assert.NoError(t, err)
+	downloader, err = NewDownloader(config)
+	assert.NoError(t, err)
+	data, err = downloader.DownloadBytes("test3")
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart", string(data))
+}
+
+func TestLocalBackend_MultipartLister(t *testing.T) {
+	b, err := NewLocalBackend(t.TempDir())
+	assert.NoError(t, err)
+	testMultipartLister(t, b)
+}
+
+func TestLocalBackend_PutOptions(t *testing.T) {
+	b, err := NewLocalBackend(t.TempDir())
+	assert.NoError(t, err)
+	testPutOptions(t, b)
+}
+
+func TestLocalBackend_Metadata(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	b, err := NewLocalBackend(root)
+	assert.NoError(t, err)
+	metadata := map[string]string{"checksum-md5": md5Hex([]byte("data"))}
+	err = b.PutObject(ctx, "dir/file", bytes.NewReader([]byte("data")), 4, &PutOptions{Metadata: metadata})
+	assert.NoError(t, err)
+
+	// 元数据保存在文件中，重新打开后仍然可以读取
+	b, err = NewLocalBackend(root)
+	assert.NoError(t, err)
+	entry, err := b.HeadObject(ctx, "dir/file")
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, entry.Metadata)
+
+	// 元数据文件不会被列举出来
+	entries, _, _, err := b.ListObjects(ctx, "", "", "", 1000)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "dir/file", entries[0].Key)
+
+	// 文件在后端之外被修改后元数据失效
+	err = os.WriteFile(filepath.Join(root, "dir", "file"), []byte("changed"), 0644)
+	assert.NoError(t, err)
+	entry, err = b.HeadObject(ctx, "dir/file")
+	assert.NoError(t, err)
+	assert.Nil(t, entry.Metadata)
+
+	// 不带元数据覆盖时清除旧的元数据
+	err = b.PutObject(ctx, "dir/file", bytes.NewReader([]byte("data")), 4, &PutOptions{Metadata: metadata})
+	assert.NoError(t, err)
+	err = b.PutObject(ctx, "dir/file", bytes.NewReader([]byte("data")), 4, nil)
+	assert.NoError(t, err)
+	entry, err = b.HeadObject(ctx, "dir/file")
+	assert.NoError(t, err)
+	assert.Nil(t, entry.Metadata)
+
+	// 删除对象时一并删除元数据文件
+	err = b.PutObject(ctx, "dir/file", bytes.NewReader([]byte("data")), 4, &PutOptions{Metadata: metadata})
+	assert.NoError(t, err)
+	assert.NoError(t, b.DeleteObject(ctx, "dir/file"))
+	_, err = os.Stat(filepath.Join(root, localMetaDir))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLocalBackend_GetIfMatch(t *testing.T) {
+	b, err := NewLocalBackend(t.TempDir())
+	assert.NoError(t, err)
+	testGetIfMatch(t, b)
+}
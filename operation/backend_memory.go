@@ -0,0 +1,345 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend 内存存储后端，主要用于单元测试
+// 返回的错误为包装了 obs.ObsError 的 *Error，状态码与 OBS 保持一致
+type MemoryBackend struct {
+	mu           sync.RWMutex
+	objects      map[string]*memoryObject
+	uploads      map[string]*memoryUpload
+	deleteErrors map[string]*DeleteKeysError
+	nextUploadID int
+}
+
+type memoryObject struct {
+	data []byte
+	Entry
+}
+
+type memoryUpload struct {
+	key       string
+	initiated time.Time
+	metadata  map[string]string
+	parts     map[int][]byte
+}
+
+// NewMemoryBackend 创建内存存储后端
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		objects:      make(map[string]*memoryObject),
+		uploads:      make(map[string]*memoryUpload),
+		deleteErrors: make(map[string]*DeleteKeysError),
+	}
+}
+
+// SetDeleteError 使批量删除指定对象时返回给定的错误，code 为空时取消设置
+func (b *MemoryBackend) SetDeleteError(key, code, message string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if code == "" {
+		delete(b.deleteErrors, key)
+		return
+	}
+	b.deleteErrors[key] = &DeleteKeysError{Name: key, Code: code, Message: message}
+}
+
+func (b *MemoryBackend) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return newObsError(http.StatusBadRequest, "IncompleteBody", "body length does not match content length")
+	}
+	sum := md5.Sum(data)
+	if err = checkContentMD5(opts, sum[:]); err != nil {
+		return err
+	}
+
+	var metadata map[string]string
+	if opts != nil {
+		metadata = opts.Metadata
+	}
+	b.putObject(key, data, hex.EncodeToString(sum[:]), metadata)
+	return nil
+}
+
+func (b *MemoryBackend) putObject(key string, data []byte, etag string, metadata map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.objects[key] = &memoryObject{
+		data: data,
+		Entry: Entry{
+			Hash:     `"` + etag + `"`,
+			Fsize:    int64(len(data)),
+			PutTime:  time.Now().UTC().Truncate(time.Second),
+			Metadata: metadata,
+		},
+	}
+}
+
+func (b *MemoryBackend) getObject(key string) (*memoryObject, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, ok := b.objects[key]
+	if !ok {
+		return nil, newObsError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+	}
+	return obj, nil
+}
+
+func (b *MemoryBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	obj, err := b.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkIfMatch(opts, obj.Hash); err != nil {
+		return nil, err
+	}
+	data := obj.data
+	if opts != nil && opts.Range != nil {
+		start, end, ok := resolveRange(opts.Range, int64(len(data)))
+		if !ok {
+			return nil, newObsError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range cannot be satisfied.")
+		}
+		data = data[start:end]
+	}
+	return &GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Entry:         obj.Entry,
+	}, nil
+}
+
+func (b *MemoryBackend) HeadObject(ctx context.Context, key string) (*Entry, error) {
+	obj, err := b.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	entry := obj.Entry
+	return &entry, nil
+}
+
+func (b *MemoryBackend) ListObjects(ctx context.Context, prefix, delimiter, marker string, limit int) ([]ListItem, []string, string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	keys, commonPrefixes, nextMarker := paginateKeys(keys, prefix, delimiter, marker, limit)
+
+	entries := make([]ListItem, len(keys))
+	for i, key := range keys {
+		obj := b.objects[key]
+		entries[i] = ListItem{
+			Key:     key,
+			Hash:    obj.Hash,
+			Fsize:   obj.Fsize,
+			PutTime: obj.PutTime,
+		}
+	}
+	return entries, commonPrefixes, nextMarker, nil
+}
+
+func (b *MemoryBackend) DeleteObject(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *MemoryBackend) DeleteObjects(ctx context.Context, keys []string) ([]*DeleteKeysError, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errs []*DeleteKeysError
+	for _, key := range keys {
+		if e, ok := b.deleteErrors[key]; ok {
+			errs = append(errs, &DeleteKeysError{Name: e.Name, Code: e.Code, Message: e.Message})
+			continue
+		}
+		delete(b.objects, key)
+	}
+	return errs, nil
+}
+
+func (b *MemoryBackend) InitiateMultipartUpload(ctx context.Context, key string, opts *PutOptions) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextUploadID++
+	uploadID := fmt.Sprintf("memory-upload-%d", b.nextUploadID)
+	upload := &memoryUpload{key: key, initiated: time.Now().UTC(), parts: make(map[int][]byte)}
+	if opts != nil {
+		upload.metadata = opts.Metadata
+	}
+	b.uploads[uploadID] = upload
+	return uploadID, nil
+}
+
+func (b *MemoryBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(data)
+	if err = checkContentMD5(opts, sum[:]); err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		return "", newObsError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	}
+	upload.parts[partNumber] = data
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+func (b *MemoryBackend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	b.mu.Lock()
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		b.mu.Unlock()
+		return newObsError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	}
+
+	var (
+		data bytes.Buffer
+		sums []byte
+	)
+	for i, part := range parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || (i > 0 && part.PartNumber <= parts[i-1].PartNumber) {
+			b.mu.Unlock()
+			return newObsError(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+		}
+		sum := md5.Sum(partData)
+		if part.ETag != "" && strings.Trim(part.ETag, `"`) != hex.EncodeToString(sum[:]) {
+			b.mu.Unlock()
+			return newObsError(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+		}
+		data.Write(partData)
+		sums = append(sums, sum[:]...)
+	}
+	delete(b.uploads, uploadID)
+	b.mu.Unlock()
+
+	sum := md5.Sum(sums)
+	b.putObject(key, data.Bytes(), fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(parts)), upload.metadata)
+	return nil
+}
+
+func (b *MemoryBackend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		return newObsError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	}
+	delete(b.uploads, uploadID)
+	return nil
+}
+
+func (b *MemoryBackend) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var uploads []MultipartUpload
+	for uploadID, upload := range b.uploads {
+		if strings.HasPrefix(upload.key, prefix) {
+			uploads = append(uploads, MultipartUpload{Key: upload.key, UploadID: uploadID, Initiated: upload.initiated})
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	return uploads, nil
+}
+
+func (b *MemoryBackend) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != key {
+		return nil, newObsError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+	}
+	parts := make([]Part, 0, len(upload.parts))
+	for partNumber, data := range upload.parts {
+		sum := md5.Sum(data)
+		parts = append(parts, Part{PartNumber: partNumber, ETag: `"` + hex.EncodeToString(sum[:]) + `"`, Size: int64(len(data))})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// 指定了 ContentMD5 且与收到的数据的 MD5 不同时返回 400 错误
+func checkContentMD5(opts *PutOptions, sum []byte) error {
+	if opts != nil && opts.ContentMD5 != "" && opts.ContentMD5 != base64.StdEncoding.EncodeToString(sum) {
+		return newObsError(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+	}
+	return nil
+}
+
+// 指定了 IfMatch 且与对象的 ETag 不同时返回 412 错误
+func checkIfMatch(opts *GetOptions, etag string) error {
+	if opts != nil && opts.IfMatch != "" && opts.IfMatch != etag {
+		return newObsError(http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold.")
+	}
+	return nil
+}
+
+// 计算下载范围在数据中的起止位置 [start, end)
+func resolveRange(r *Range, size int64) (start, end int64, ok bool) {
+	switch {
+	case r.Offset == -1:
+		// 空对象不存在可返回的后缀，与 OBS 一致返回 416
+		if r.Size <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		start = size - r.Size
+		if start < 0 {
+			start = 0
+		}
+		return start, size, true
+	case r.Offset < 0 || r.Offset >= size:
+		return 0, 0, false
+	case r.Size == -1:
+		return r.Offset, size, true
+	case r.Size <= 0:
+		return 0, 0, false
+	}
+	end = r.Offset + r.Size
+	if end > size {
+		end = size
+	}
+	return r.Offset, end, true
+}
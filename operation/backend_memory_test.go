@@ -0,0 +1,262 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBackend_GetObjectRange(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	err := b.PutObject(ctx, "range", bytes.NewReader([]byte("0123456789")), 10, nil)
+	assert.NoError(t, err)
+
+	type TestCase struct {
+		rng      Range
+		expected string
+	}
+	testCases := []TestCase{
+		{rng: Range{Offset: 0, Size: 1}, expected: "0"},
+		{rng: Range{Offset: 3, Size: 4}, expected: "3456"},
+		{rng: Range{Offset: 8, Size: 10}, expected: "89"},
+		{rng: Range{Offset: -1, Size: 4}, expected: "6789"},
+		{rng: Range{Offset: 5, Size: -1}, expected: "56789"},
+	}
+	for _, tc := range testCases {
+		rng := tc.rng
+		output, err := b.GetObject(ctx, "range", &GetOptions{Range: &rng})
+		assert.NoError(t, err)
+		data, err := io.ReadAll(output.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, string(data))
+		assert.Equal(t, int64(len(tc.expected)), output.ContentLength)
+		assert.Equal(t, int64(10), output.Fsize)
+	}
+
+	// 超出范围
+	_, err = b.GetObject(ctx, "range", &GetOptions{Range: &Range{Offset: 10, Size: 1}})
+	assert.Equal(t, 416, statusCodeOf(err))
+
+	// 空对象的后缀范围
+	err = b.PutObject(ctx, "empty", bytes.NewReader(nil), 0, nil)
+	assert.NoError(t, err)
+	_, err = b.GetObject(ctx, "empty", &GetOptions{Range: &Range{Offset: -1, Size: 4}})
+	assert.Equal(t, 416, statusCodeOf(err))
+	assert.ErrorIs(t, err, ErrRangeNotSatisfiable)
+
+	// 不存在的对象
+	_, err = b.GetObject(ctx, "not-exist", nil)
+	assert.Equal(t, 404, statusCodeOf(err))
+}
+
+func TestMemoryBackend_ListObjects(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	for i := 0; i < 5; i++ {
+		err := b.PutObject(ctx, fmt.Sprintf("list/%d", i), bytes.NewReader(nil), 0, nil)
+		assert.NoError(t, err)
+	}
+	err := b.PutObject(ctx, "list/dir/a", bytes.NewReader(nil), 0, nil)
+	assert.NoError(t, err)
+
+	// 分页列举
+	var (
+		keys   []string
+		marker string
+	)
+	for {
+		entries, _, nextMarker, err := b.ListObjects(ctx, "list/", "", marker, 2)
+		assert.NoError(t, err)
+		for _, entry := range entries {
+			keys = append(keys, entry.Key)
+		}
+		if nextMarker == "" {
+			break
+		}
+		marker = nextMarker
+	}
+	assert.Equal(t, []string{"list/0", "list/1", "list/2", "list/3", "list/4", "list/dir/a"}, keys)
+
+	// 目录分隔符
+	entries, commonPrefixes, _, err := b.ListObjects(ctx, "list/", "/", "", 1000)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, []string{"list/dir/"}, commonPrefixes)
+}
+
+func TestMemoryBackend_DeleteObjectsError(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	for _, key := range []string{"a", "b", "c"} {
+		err := b.PutObject(ctx, key, bytes.NewReader(nil), 0, nil)
+		assert.NoError(t, err)
+	}
+	b.SetDeleteError("b", "AccessDenied", "Access Denied")
+
+	errs, err := b.DeleteObjects(ctx, []string{"a", "b", "c"})
+	assert.NoError(t, err)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "b", errs[0].Name)
+	assert.Equal(t, "AccessDenied", errs[0].Code)
+
+	_, err = b.HeadObject(ctx, "a")
+	assert.Equal(t, 404, statusCodeOf(err))
+	_, err = b.HeadObject(ctx, "b")
+	assert.NoError(t, err)
+}
+
+func TestMemoryBackend_MultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+
+	uploadID, err := b.InitiateMultipartUpload(ctx, "multipart", nil)
+	assert.NoError(t, err)
+
+	var parts []Part
+	for i, data := range []string{"hello ", "world"} {
+		etag, err := b.UploadPart(ctx, "multipart", uploadID, i+1, bytes.NewReader([]byte(data)), int64(len(data)), nil)
+		assert.NoError(t, err)
+		parts = append(parts, Part{PartNumber: i + 1, ETag: etag})
+	}
+	err = b.CompleteMultipartUpload(ctx, "multipart", uploadID, parts)
+	assert.NoError(t, err)
+
+	output, err := b.GetObject(ctx, "multipart", nil)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(output.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.Contains(t, output.Hash, "-2")
+
+	// 合并后 uploadID 失效
+	err = b.AbortMultipartUpload(ctx, "multipart", uploadID)
+	assert.Equal(t, 404, statusCodeOf(err))
+}
+
+// 检查后端列举未完成的分片上传和已上传的分片
+func testMultipartLister(t *testing.T, b Backend) {
+	ctx := context.Background()
+	lister, ok := b.(MultipartLister)
+	assert.True(t, ok)
+
+	uploadID, err := b.InitiateMultipartUpload(ctx, "dir/a", nil)
+	assert.NoError(t, err)
+	otherID, err := b.InitiateMultipartUpload(ctx, "other", nil)
+	assert.NoError(t, err)
+	for _, partNumber := range []int{2, 1} {
+		data := fmt.Sprintf("part-%d", partNumber)
+		_, err = b.UploadPart(ctx, "dir/a", uploadID, partNumber, bytes.NewReader([]byte(data)), int64(len(data)), nil)
+		assert.NoError(t, err)
+	}
+
+	uploads, err := lister.ListMultipartUploads(ctx, "dir/")
+	assert.NoError(t, err)
+	if assert.Len(t, uploads, 1) {
+		assert.Equal(t, "dir/a", uploads[0].Key)
+		assert.Equal(t, uploadID, uploads[0].UploadID)
+		assert.False(t, uploads[0].Initiated.IsZero())
+	}
+	uploads, err = lister.ListMultipartUploads(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, uploads, 2)
+
+	parts, err := lister.ListParts(ctx, "dir/a", uploadID)
+	assert.NoError(t, err)
+	if assert.Len(t, parts, 2) {
+		assert.Equal(t, 1, parts[0].PartNumber)
+		assert.Equal(t, 2, parts[1].PartNumber)
+		assert.Equal(t, int64(len("part-1")), parts[0].Size)
+		assert.Equal(t, `"`+md5Hex([]byte("part-1"))+`"`, parts[0].ETag)
+	}
+	parts, err = lister.ListParts(ctx, "other", otherID)
+	assert.NoError(t, err)
+	assert.Empty(t, parts)
+
+	// 合并后不再列出
+	err = b.CompleteMultipartUpload(ctx, "dir/a", uploadID, []Part{{PartNumber: 1, ETag: `"` + md5Hex([]byte("part-1")) + `"`}})
+	assert.NoError(t, err)
+	uploads, err = lister.ListMultipartUploads(ctx, "dir/")
+	assert.NoError(t, err)
+	assert.Empty(t, uploads)
+	_, err = lister.ListParts(ctx, "dir/a", uploadID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMemoryBackend_MultipartLister(t *testing.T) {
+	testMultipartLister(t, NewMemoryBackend())
+}
+
+// 检查后端按 If-Match 条件下载
+func testGetIfMatch(t *testing.T, b Backend) {
+	ctx := context.Background()
+	assert.NoError(t, b.PutObject(ctx, "if-match", bytes.NewReader([]byte("0123456789")), 10, nil))
+	entry, err := b.HeadObject(ctx, "if-match")
+	assert.NoError(t, err)
+
+	output, err := b.GetObject(ctx, "if-match", &GetOptions{Range: &Range{Offset: 2, Size: 3}, IfMatch: entry.Hash})
+	assert.NoError(t, err)
+	data, err := io.ReadAll(output.Body)
+	output.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "234", string(data))
+
+	// 对象已被覆盖
+	assert.NoError(t, b.PutObject(ctx, "if-match", bytes.NewReader([]byte("abcdefghij")), 10, nil))
+	_, err = b.GetObject(ctx, "if-match", &GetOptions{Range: &Range{Offset: 2, Size: 3}, IfMatch: entry.Hash})
+	assert.True(t, errors.Is(err, ErrPreconditionFailed))
+}
+
+func TestMemoryBackend_GetIfMatch(t *testing.T) {
+	testGetIfMatch(t, NewMemoryBackend())
+}
+
+// 检查后端校验 Content-MD5 并保存自定义元数据
+func testPutOptions(t *testing.T, b Backend) {
+	ctx := context.Background()
+	data := []byte("0123456789")
+	contentMD5, _, err := computeChecksum(bytes.NewReader(data), "")
+	assert.NoError(t, err)
+	badMD5, _, err := computeChecksum(bytes.NewReader([]byte("corrupted")), "")
+	assert.NoError(t, err)
+	opts := &PutOptions{ContentMD5: contentMD5, Metadata: map[string]string{"checksum-md5": md5Hex(data)}}
+
+	err = b.PutObject(ctx, "put-options", bytes.NewReader(data), 10, &PutOptions{ContentMD5: badMD5})
+	assert.Equal(t, 400, statusCodeOf(err))
+	assert.NoError(t, b.PutObject(ctx, "put-options", bytes.NewReader(data), 10, opts))
+	entry, err := b.HeadObject(ctx, "put-options")
+	assert.NoError(t, err)
+	output, err := b.GetObject(ctx, "put-options", nil)
+	assert.NoError(t, err)
+	output.Body.Close()
+	assert.Equal(t, md5Hex(data), entry.Metadata["checksum-md5"])
+	assert.Equal(t, md5Hex(data), output.Metadata["checksum-md5"])
+
+	// 分片上传的元数据在初始化时指定
+	uploadID, err := b.InitiateMultipartUpload(ctx, "put-options-multipart", opts)
+	assert.NoError(t, err)
+	_, err = b.UploadPart(ctx, "put-options-multipart", uploadID, 1, bytes.NewReader(data), 10, &PutOptions{ContentMD5: badMD5})
+	assert.Equal(t, 400, statusCodeOf(err))
+	etag, err := b.UploadPart(ctx, "put-options-multipart", uploadID, 1, bytes.NewReader(data), 10, &PutOptions{ContentMD5: contentMD5})
+	assert.NoError(t, err)
+	assert.NoError(t, b.CompleteMultipartUpload(ctx, "put-options-multipart", uploadID, []Part{{PartNumber: 1, ETag: etag, Size: 10}}))
+	entry, err = b.HeadObject(ctx, "put-options-multipart")
+	assert.NoError(t, err)
+	assert.Equal(t, md5Hex(data), entry.Metadata["checksum-md5"])
+}
+
+func TestMemoryBackend_PutOptions(t *testing.T) {
+	testPutOptions(t, NewMemoryBackend())
+}
@@ -0,0 +1,470 @@
+package operation
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+)
+
+// obsBackend 华为云 OBS 存储后端
+type obsBackend struct {
+	bucket string
+	// 所有请求共用的 ObsClient。SDK 只支持在创建 ObsClient 时设置请求上下文，
+	// 这里通过 contexts 在 Transport 中为每个请求设置上下文，不为每个请求创建 ObsClient。
+	// SDK 的重试无法被取消，不使用 SDK 的重试，由 RetryPolicy 统一控制
+	client   *obs.ObsClient
+	contexts *contextTransport
+}
+
+// NewOBSBackend 根据配置创建华为云 OBS 存储后端
+func NewOBSBackend(c *Config) (Backend, error) {
+	return newOBSBackend(c, func(httpClient *http.Client, transport *http.Transport) (*obs.ObsClient, error) {
+		return obs.New(c.Ak, c.Sk, c.EndPoint,
+			obs.WithHttpClient(httpClient),
+			obs.WithHttpTransport(transport),
+			obs.WithMaxRetryCount(0),
+		)
+	})
+}
+
+// 创建 http.Client 后用 newClient 创建共用的 ObsClient
+func newOBSBackend(c *Config, newClient func(httpClient *http.Client, transport *http.Transport) (*obs.ObsClient, error)) (Backend, error) {
+	httpClient, contexts, err := newOBSHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClient(httpClient, contexts.base)
+	if err != nil {
+		return nil, err
+	}
+	return &obsBackend{bucket: c.Bucket, client: client, contexts: contexts}, nil
+}
+
+// 返回传给 SDK 方法的扩展参数，使请求使用 ctx，SDK 方法返回后调用 done
+func (b *obsBackend) requestContext(ctx context.Context) (extension interface{}, done func()) {
+	return b.contexts.register(ctx)
+}
+
+// 请求上下文的请求头，值为登记的上下文编号。SDK 只保留 x-amz-、x-obs- 开头的自定义请求头，
+// 其余的会被当作用户元数据或丢弃
+const contextHeader = "x-amz-sdk-request-context"
+
+// 按请求头中的编号为请求设置登记的上下文。请求头可能参与签名，发送时保留，服务端会忽略
+type contextTransport struct {
+	base     *http.Transport
+	next     uint64
+	contexts sync.Map
+}
+
+func (t *contextTransport) register(ctx context.Context) (interface{}, func()) {
+	id := strconv.FormatUint(atomic.AddUint64(&t.next, 1), 10)
+	t.contexts.Store(id, ctx)
+	return obs.WithCustomHeader(contextHeader, id), func() {
+		t.contexts.Delete(id)
+	}
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// SDK 直接设置 req.Header，请求头名没有规范化
+	if values := req.Header[contextHeader]; len(values) > 0 {
+		if ctx, ok := t.contexts.Load(values[0]); ok {
+			req = req.WithContext(ctx.(context.Context))
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// 与 OBS SDK 默认的连接设置保持一致：读写超时 60 秒、不压缩、不跟随重定向，
+// 代理和证书校验由 Config.ProxyURL、Config.SSLVerify、Config.PemCerts 设置。
+// 同时返回为请求设置上下文的 Transport
+func newOBSHTTPClient(c *Config) (*http.Client, *contextTransport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !c.SSLVerify}
+	if c.SSLVerify && len(c.PemCerts) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.PemCerts) {
+			return nil, nil, fmt.Errorf("no valid certificate in PemCerts")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	var proxy func(*http.Request) (*url.URL, error)
+	if c.ProxyURL != "" {
+		proxyURL, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid proxy url %q: %w", c.ProxyURL, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{Timeout: 60 * time.Second, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &deadlineConn{Conn: conn, timeout: 60 * time.Second}, nil
+		},
+		Proxy:                 proxy,
+		MaxIdleConns:          1000,
+		MaxIdleConnsPerHost:   1000,
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       30 * time.Second,
+		TLSClientConfig:       tlsConfig,
+		DisableCompression:    true,
+	}
+	contexts := &contextTransport{base: transport}
+	return &http.Client{
+		Transport: contexts,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, contexts, nil
+}
+
+// 每次读写前刷新超时时间，避免连接长时间卡住
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// 指定了 Content-MD5 时还会比较返回的 ETag，防止不校验 Content-MD5 的兼容服务静默地保存错误的数据
+func (b *obsBackend) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.PutObjectInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	input.Body = body
+	if size >= 0 {
+		input.ContentLength = size
+	}
+	if opts != nil {
+		input.ContentMD5 = opts.ContentMD5
+		input.Metadata = opts.Metadata
+	}
+	output, err := b.client.PutObject(input, extension)
+	if err != nil {
+		return wrapError(err)
+	}
+	if opts != nil {
+		return checkETag(output.ETag, opts.ContentMD5)
+	}
+	return nil
+}
+
+func (b *obsBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.GetObjectInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	if opts != nil {
+		input.IfMatch = opts.IfMatch
+	}
+
+	var (
+		output *obs.GetObjectOutput
+		err    error
+	)
+	if opts != nil && opts.Range != nil {
+		output, err = b.client.GetObject(input, obs.WithCustomHeader("Range", opts.Range.String()), extension)
+	} else {
+		output, err = b.client.GetObject(input, extension)
+	}
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	if opts != nil && opts.Range != nil && output.StatusCode != http.StatusPartialContent {
+		output.Body.Close()
+		return nil, &Error{
+			StatusCode: output.StatusCode,
+			Code:       "UnexpectedStatus",
+			Message:    "range request was not answered with 206 Partial Content",
+			RequestID:  output.RequestId,
+		}
+	}
+
+	size := output.ContentLength
+	if total, ok := parseContentRangeTotal(output.ResponseHeaders); ok {
+		size = total
+	}
+	return &GetObjectOutput{
+		Body:          output.Body,
+		ContentLength: output.ContentLength,
+		Entry: Entry{
+			Hash:     output.ETag,
+			Fsize:    size,
+			PutTime:  output.LastModified,
+			MimeType: output.ContentType,
+			Metadata: output.Metadata,
+		},
+	}, nil
+}
+
+func (b *obsBackend) HeadObject(ctx context.Context, key string) (*Entry, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.GetObjectMetadataInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	output, err := b.client.GetObjectMetadata(input, extension)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &Entry{
+		Hash:     output.ETag,
+		Fsize:    output.ContentLength,
+		PutTime:  output.LastModified,
+		MimeType: output.ContentType,
+		Metadata: output.Metadata,
+	}, nil
+}
+
+func (b *obsBackend) ListObjects(ctx context.Context, prefix, delimiter, marker string, limit int) ([]ListItem, []string, string, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.ListObjectsInput{}
+	input.Bucket = b.bucket
+	input.Prefix = prefix
+	input.Delimiter = delimiter
+	input.Marker = marker
+	input.MaxKeys = limit
+	input.EncodingType = "url"
+	output, err := b.client.ListObjects(input, extension)
+	if err != nil {
+		return nil, nil, "", wrapError(err)
+	}
+	return convertListItem(output.Contents), output.CommonPrefixes, nextListMarker(output), nil
+}
+
+// 下一页的 marker。MinIO、Ceph RGW 等 S3 兼容服务在没有 delimiter 时不返回 NextMarker，
+// 此时使用本页最后的 key 或公共前缀；没有下一页时返回空字符串
+func nextListMarker(output *obs.ListObjectsOutput) string {
+	if !output.IsTruncated || output.NextMarker != "" {
+		return output.NextMarker
+	}
+	var marker string
+	if n := len(output.Contents); n > 0 {
+		marker = output.Contents[n-1].Key
+	}
+	if n := len(output.CommonPrefixes); n > 0 && output.CommonPrefixes[n-1] > marker {
+		marker = output.CommonPrefixes[n-1]
+	}
+	return marker
+}
+
+func (b *obsBackend) DeleteObject(ctx context.Context, key string) error {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.DeleteObjectInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	_, err := b.client.DeleteObject(input, extension)
+	return wrapError(err)
+}
+
+func (b *obsBackend) DeleteObjects(ctx context.Context, keys []string) ([]*DeleteKeysError, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.DeleteObjectsInput{}
+	input.Bucket = b.bucket
+	input.Objects = make([]obs.ObjectToDelete, len(keys))
+	for i, key := range keys {
+		input.Objects[i] = obs.ObjectToDelete{Key: key}
+	}
+	output, err := b.client.DeleteObjects(input, extension)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	errs := make([]*DeleteKeysError, len(output.Errors))
+	for i, v := range output.Errors {
+		errs[i] = &DeleteKeysError{
+			Name:    v.Key,
+			Message: v.Message,
+			Code:    v.Code,
+		}
+	}
+	return errs, nil
+}
+
+func (b *obsBackend) InitiateMultipartUpload(ctx context.Context, key string, opts *PutOptions) (string, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.InitiateMultipartUploadInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	if opts != nil {
+		input.Metadata = opts.Metadata
+	}
+	output, err := b.client.InitiateMultipartUpload(input, extension)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return output.UploadId, nil
+}
+
+func (b *obsBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (string, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.UploadPartInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	input.UploadId = uploadID
+	input.PartNumber = partNumber
+	input.Body = body
+	input.PartSize = size
+	if opts != nil {
+		input.ContentMD5 = opts.ContentMD5
+	}
+	output, err := b.client.UploadPart(input, extension)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	if opts != nil {
+		if err = checkETag(output.ETag, opts.ContentMD5); err != nil {
+			return "", err
+		}
+	}
+	return output.ETag, nil
+}
+
+func (b *obsBackend) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.CompleteMultipartUploadInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	input.UploadId = uploadID
+	input.Parts = make([]obs.Part, len(parts))
+	for i, part := range parts {
+		input.Parts[i] = obs.Part{PartNumber: part.PartNumber, ETag: part.ETag}
+	}
+	_, err := b.client.CompleteMultipartUpload(input, extension)
+	return wrapError(err)
+}
+
+func (b *obsBackend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	input := &obs.AbortMultipartUploadInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	input.UploadId = uploadID
+	_, err := b.client.AbortMultipartUpload(input, extension)
+	return wrapError(err)
+}
+
+// ListMultipartUploads 分页列举以 prefix 开头的对象上未完成的分片上传
+func (b *obsBackend) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	var uploads []MultipartUpload
+	input := &obs.ListMultipartUploadsInput{}
+	input.Bucket = b.bucket
+	input.Prefix = prefix
+	input.EncodingType = "url"
+	for {
+		output, err := b.client.ListMultipartUploads(input, extension)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, upload := range output.Uploads {
+			uploads = append(uploads, MultipartUpload{Key: upload.Key, UploadID: upload.UploadId, Initiated: upload.Initiated})
+		}
+		if !output.IsTruncated {
+			return uploads, nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+}
+
+// ListParts 分页列举分片上传中已上传的分片
+func (b *obsBackend) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	var parts []Part
+	input := &obs.ListPartsInput{}
+	input.Bucket = b.bucket
+	input.Key = key
+	input.UploadId = uploadID
+	for {
+		output, err := b.client.ListParts(input, extension)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, part := range output.Parts {
+			parts = append(parts, Part{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size})
+		}
+		if !output.IsTruncated {
+			return parts, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+// StatBucket 获取桶元数据，只有 OBS 后端支持
+func (b *obsBackend) StatBucket(ctx context.Context) (*obs.GetBucketMetadataOutput, error) {
+	extension, done := b.requestContext(ctx)
+	defer done()
+
+	output, err := b.client.GetBucketMetadata(&obs.GetBucketMetadataInput{Bucket: b.bucket}, extension)
+	return output, wrapError(err)
+}
+
+// 从 Content-Range 响应头中解析对象总长度，如 bytes 0-3/10
+func parseContentRangeTotal(headers map[string][]string) (int64, bool) {
+	values := headers["content-range"]
+	if len(values) == 0 {
+		return 0, false
+	}
+	i := strings.LastIndex(values[0], "/")
+	if i < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(values[0][i+1:], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
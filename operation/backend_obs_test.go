@@ -0,0 +1,235 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gh-efforts/go-sdk-obs/operation/obstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func getOBSTestConfig(t *testing.T) *Config {
+	server := obstest.NewServer("bucket")
+	t.Cleanup(server.Close)
+	return &Config{
+		Ak:       server.AccessKey,
+		Sk:       server.SecretKey,
+		EndPoint: server.URL,
+		Bucket:   "bucket",
+	}
+}
+
+func TestOBSBackend_UploadDownload(t *testing.T) {
+	config := getOBSTestConfig(t)
+
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	err = uploader.UploadData([]byte("0123456789"), "/dir/test1")
+	assert.NoError(t, err)
+
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	data, err := downloader.DownloadBytes("dir/test1")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+
+	l, data, err := downloader.DownloadRangeBytes("dir/test1", 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), l)
+	assert.Equal(t, "234", string(data))
+
+	l, err = downloader.DownloadCheck("dir/test1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), l)
+
+	_, err = downloader.DownloadBytes("not-exist")
+	assert.Equal(t, 404, statusCodeOf(err))
+}
+
+func TestOBSBackend_UploadMultipart(t *testing.T) {
+	config := getOBSTestConfig(t)
+	backend, err := NewOBSBackend(config)
+	assert.NoError(t, err)
+
+	data := []byte("hello multipart world")
+	err = uploadSmallParts(t, backend, data, "multipart")
+	assert.NoError(t, err)
+
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	downloaded, err := downloader.DownloadBytes("multipart")
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+}
+
+func TestOBSBackend_MultipartLister(t *testing.T) {
+	backend, err := NewOBSBackend(getOBSTestConfig(t))
+	assert.NoError(t, err)
+	testMultipartLister(t, backend)
+}
+
+func TestOBSBackend_PutOptions(t *testing.T) {
+	backend, err := NewOBSBackend(getOBSTestConfig(t))
+	assert.NoError(t, err)
+	testPutOptions(t, backend)
+}
+
+func TestOBSBackend_GetIfMatch(t *testing.T) {
+	backend, err := NewOBSBackend(getOBSTestConfig(t))
+	assert.NoError(t, err)
+	testGetIfMatch(t, backend)
+}
+
+func TestOBSBackend_Lister(t *testing.T) {
+	config := getOBSTestConfig(t)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("lister/%d", i)
+		keys = append(keys, key)
+		err := uploader.UploadData([]byte(key), key)
+		assert.NoError(t, err)
+	}
+
+	// 分页列举
+	entries, _, marker, err := lister.clusterLister.(*singleClusterLister).list(context.Background(), "lister/", "", "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "lister/1", marker)
+
+	assert.Equal(t, keys, mustListPrefix(t, lister, "lister/"))
+
+	stats, err := lister.ListStat([]string{"lister/0", "not-exist"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), stats[0].Size)
+	assert.Equal(t, int64(-1), stats[1].Size)
+	assert.Equal(t, 404, stats[1].Code)
+	assert.ErrorIs(t, stats[1].Err, ErrNotFound)
+
+	entry, err := lister.Stat("lister/0")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), entry.Fsize)
+
+	_, err = lister.DeleteKeys(keys[:3])
+	assert.NoError(t, err)
+	err = lister.Delete(keys[3])
+	assert.NoError(t, err)
+	assert.Equal(t, keys[4:], mustListPrefix(t, lister, "lister/"))
+
+	_, err = lister.StatBucket()
+	assert.NoError(t, err)
+}
+
+func TestOBSBackend_Context(t *testing.T) {
+	config := getOBSTestConfig(t)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = uploader.UploadDataContext(ctx, []byte("data"), "key")
+	assert.NoError(t, err)
+	data, err := downloader.DownloadBytesContext(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = uploader.UploadDataContext(canceled, []byte("data"), "canceled")
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = downloader.DownloadBytesContext(canceled, "key")
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = lister.StatContext(canceled, "key")
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = lister.DeleteKeysContext(canceled, []string{"key"})
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, err = lister.ListPrefixContext(canceled, "")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, []string{"key"}, mustListPrefix(t, lister, ""))
+}
+
+func TestOBSBackend_SSLVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	pemCerts := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	type TestCase struct {
+		sslVerify bool
+		pemCerts  []byte
+		verified  bool
+	}
+	testCases := []TestCase{
+		// 默认不校验证书
+		{sslVerify: false, verified: true},
+		{sslVerify: true, verified: false},
+		{sslVerify: true, pemCerts: pemCerts, verified: true},
+	}
+	for _, tc := range testCases {
+		backend, err := NewOBSBackend(&Config{Ak: "ak", Sk: "sk", EndPoint: server.URL, Bucket: "bucket", SSLVerify: tc.sslVerify, PemCerts: tc.pemCerts})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err = backend.HeadObject(ctx, "key")
+		cancel()
+		if tc.verified {
+			assert.True(t, errors.Is(err, ErrNotFound), "%v", err)
+		} else {
+			assert.Error(t, err)
+			assert.False(t, errors.Is(err, ErrNotFound))
+		}
+	}
+
+	_, err := NewOBSBackend(&Config{EndPoint: server.URL, SSLVerify: true, PemCerts: []byte("invalid")})
+	assert.Error(t, err)
+}
+
+func TestOBSBackend_RequestContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	for _, typ := range []string{BackendTypeOBS, BackendTypeS3} {
+		backend, err := newBackend(&Config{Ak: "ak", Sk: "sk", EndPoint: server.URL, Bucket: "bucket", Type: typ})
+		assert.NoError(t, err)
+		// 共用的 ObsClient 通过 Transport 使用每个请求的上下文
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = backend.HeadObject(ctx, "key")
+		cancel()
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "%s: %v", typ, err)
+		// 请求结束后不再保留上下文
+		n := 0
+		backend.(*obsBackend).contexts.contexts.Range(func(key, value interface{}) bool {
+			n++
+			return true
+		})
+		assert.Equal(t, 0, n)
+	}
+
+	// 上下文的请求头不会被保存为元数据
+	config := getOBSTestConfig(t)
+	backend, err := NewOBSBackend(config)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, backend.PutObject(ctx, "key", bytes.NewReader([]byte("data")), 4, nil))
+	entry, err := backend.HeadObject(ctx, "key")
+	assert.NoError(t, err)
+	assert.Empty(t, entry.Metadata)
+}
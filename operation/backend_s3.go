@@ -0,0 +1,35 @@
+package operation
+
+import (
+	"net/http"
+
+	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+)
+
+// S3 后端未配置区域时使用的默认区域
+const defaultS3Region = "us-east-1"
+
+// NewS3Backend 根据配置创建 S3 兼容存储后端（MinIO、Ceph RGW 等）
+// OBS SDK 本身兼容 S3 协议，这里使用 V4 签名和路径风格的请求，其余与 OBS 后端相同
+//
+// 限制：
+//   - 只支持 V4 签名和路径风格，不支持虚拟主机风格的域名
+//   - 列举使用 ListObjects（V1），不使用 ListObjectsV2
+//   - 单元测试只覆盖 obstest 模拟的服务端，错误码、ETag 格式和列举分页在真实 S3 上的表现
+//     需设置 S3_TEST_ENDPOINT 等环境变量运行 TestS3Backend_Integration 验证
+func NewS3Backend(c *Config) (Backend, error) {
+	region := c.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	return newOBSBackend(c, func(httpClient *http.Client, transport *http.Transport) (*obs.ObsClient, error) {
+		return obs.New(c.Ak, c.Sk, c.EndPoint,
+			obs.WithSignature(obs.SignatureV4),
+			obs.WithPathStyle(true),
+			obs.WithRegion(region),
+			obs.WithHttpClient(httpClient),
+			obs.WithHttpTransport(transport),
+			obs.WithMaxRetryCount(0),
+		)
+	})
+}
@@ -0,0 +1,223 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gh-efforts/go-sdk-obs/operation/obstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func getS3TestConfig(t *testing.T) *Config {
+	return newS3TestConfig(t, obstest.NewServer("bucket"))
+}
+
+func newS3TestConfig(t *testing.T, server *obstest.Server) *Config {
+	t.Cleanup(server.Close)
+	return &Config{
+		Ak:       server.AccessKey,
+		Sk:       server.SecretKey,
+		EndPoint: server.URL,
+		Bucket:   "bucket",
+		Type:     BackendTypeS3,
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	config := getS3TestConfig(t)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+
+	err = uploader.UploadData([]byte("0123456789"), "dir/test1")
+	assert.NoError(t, err)
+
+	// 分片上传
+	backend, err := newBackend(config)
+	assert.NoError(t, err)
+	data := []byte("hello multipart world")
+	err = uploadSmallParts(t, backend, data, "dir/multipart")
+	assert.NoError(t, err)
+
+	downloaded, err := downloader.DownloadBytes("dir/multipart")
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+
+	l, downloaded, err := downloader.DownloadRangeBytes("dir/test1", 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), l)
+	assert.Equal(t, "234", string(downloaded))
+
+	assert.Equal(t, []string{"dir/multipart", "dir/test1"}, mustListPrefix(t, lister, "dir/"))
+
+	_, err = lister.DeleteKeys([]string{"dir/multipart", "dir/test1"})
+	assert.NoError(t, err)
+	assert.Empty(t, mustListPrefix(t, lister, "dir/"))
+}
+
+func TestS3Backend_ListWithoutNextMarker(t *testing.T) {
+	server := obstest.NewServer("bucket")
+	server.OmitNextMarker = true
+	config := newS3TestConfig(t, server)
+	backend, err := newBackend(config)
+	assert.NoError(t, err)
+
+	var expected []string
+	for i := 0; i < 1001; i++ {
+		key := fmt.Sprintf("dir/%04d", i)
+		assert.NoError(t, backend.PutObject(context.Background(), key, bytes.NewReader([]byte("0")), 1, nil))
+		expected = append(expected, key)
+	}
+
+	// 没有 NextMarker 时使用本页最后的 key 继续列举
+	entries, _, marker, err := backend.ListObjects(context.Background(), "dir/", "", "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "dir/0001", marker)
+	_, _, marker, err = backend.ListObjects(context.Background(), "dir/", "", "dir/0998", 2)
+	assert.NoError(t, err)
+	assert.Empty(t, marker)
+
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, mustListPrefix(t, lister, "dir/"))
+}
+
+func TestS3Backend_Proxy(t *testing.T) {
+	server := obstest.NewServer("bucket")
+	config := newS3TestConfig(t, server)
+	// 域名无法解析，只能通过代理访问
+	config.ProxyURL = config.EndPoint
+	config.EndPoint = "http://s3.invalid"
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, uploader.UploadData([]byte("data"), "key"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	data, err := downloader.DownloadBytesContext(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	config.ProxyURL = "://"
+	_, err = NewDownloader(config)
+	assert.Error(t, err)
+}
+
+// 连接真实 S3 兼容服务（如 MinIO）的配置，未设置 S3_TEST_ENDPOINT 时跳过
+func getS3IntegrationConfig(t *testing.T) *Config {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	return &Config{
+		Ak:       os.Getenv("S3_TEST_ACCESS_KEY"),
+		Sk:       os.Getenv("S3_TEST_SECRET_KEY"),
+		EndPoint: endpoint,
+		Bucket:   os.Getenv("S3_TEST_BUCKET"),
+		Region:   os.Getenv("S3_TEST_REGION"),
+		Type:     BackendTypeS3,
+	}
+}
+
+// 在真实 S3 兼容服务上检查错误码、ETag 格式和列举，例如：
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=http://127.0.0.1:9000 S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin S3_TEST_BUCKET=test go test -run TestS3Backend_Integration
+func TestS3Backend_Integration(t *testing.T) {
+	config := getS3IntegrationConfig(t)
+	config.PartSize = 5
+	config.Checksum = ChecksumSHA256
+	ctx := context.Background()
+	backend, err := newBackend(config)
+	assert.NoError(t, err)
+	prefix := fmt.Sprintf("s3-integration-%d/", time.Now().UnixNano())
+
+	testPutOptions(t, backend)
+	testGetIfMatch(t, backend)
+
+	// 单次上传的 ETag 为内容的 MD5
+	data := []byte("0123456789")
+	assert.NoError(t, backend.PutObject(ctx, prefix+"small", bytes.NewReader(data), int64(len(data)), nil))
+	entry, err := backend.HeadObject(ctx, prefix+"small")
+	assert.NoError(t, err)
+	assert.Equal(t, `"`+md5Hex(data)+`"`, entry.Hash)
+	assert.Equal(t, int64(len(data)), entry.Fsize)
+
+	// 错误码
+	_, err = backend.HeadObject(ctx, prefix+"not-exist")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = backend.GetObject(ctx, prefix+"not-exist", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = backend.GetObject(ctx, prefix+"small", &GetOptions{Range: &Range{Offset: 10, Size: 1}})
+	assert.ErrorIs(t, err, ErrRangeNotSatisfiable)
+	_, err = backend.GetObject(ctx, prefix+"small", &GetOptions{IfMatch: `"` + md5Hex([]byte("other")) + `"`})
+	assert.ErrorIs(t, err, ErrPreconditionFailed)
+	output, err := backend.GetObject(ctx, prefix+"small", &GetOptions{Range: &Range{Offset: -1, Size: 3}})
+	if assert.NoError(t, err) {
+		tail, err := io.ReadAll(output.Body)
+		output.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "789", string(tail))
+		assert.Equal(t, int64(len(data)), output.Fsize)
+	}
+
+	// 分片上传的 ETag 不是内容的 MD5，下载时按元数据中的校验和校验
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	large := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+	assert.NoError(t, uploader.UploadReader(bytes.NewReader(large), prefix+"large"))
+	entry, err = backend.HeadObject(ctx, prefix+"large")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^"[0-9a-f]{32}-3"$`, entry.Hash)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	downloaded, err := downloader.DownloadBytes(prefix + "large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, downloaded)
+
+	// 分页列举和目录
+	keys := []string{prefix + "dir/a", prefix + "dir/b", prefix + "dir/sub/c"}
+	for _, key := range keys {
+		assert.NoError(t, backend.PutObject(ctx, key, bytes.NewReader([]byte(key)), int64(len(key)), nil))
+	}
+	var (
+		listed []string
+		marker string
+	)
+	for {
+		entries, _, nextMarker, err := backend.ListObjects(ctx, prefix+"dir/", "", marker, 2)
+		if !assert.NoError(t, err) {
+			break
+		}
+		for _, entry := range entries {
+			listed = append(listed, entry.Key)
+		}
+		if nextMarker == "" {
+			break
+		}
+		marker = nextMarker
+	}
+	assert.Equal(t, keys, listed)
+	entries, commonPrefixes, _, err := backend.ListObjects(ctx, prefix+"dir/", "/", "", 1000)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, []string{prefix + "dir/sub/"}, commonPrefixes)
+
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+	all := append([]string{prefix + "large", prefix + "small"}, keys...)
+	_, err = lister.DeleteKeys(all)
+	assert.NoError(t, err)
+	assert.Empty(t, mustListPrefix(t, lister, prefix))
+}
@@ -0,0 +1,162 @@
+package operation
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"strings"
+)
+
+// 整个对象的校验算法，见 Config.Checksum
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC64  = "crc64"
+)
+
+// 保存整个对象校验值的元数据名前缀，值为十六进制编码，如 checksum-sha256
+const checksumMetadataPrefix = "checksum-"
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC64:
+		return crc64.New(crc64Table), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q", algorithm)
+}
+
+// 检查 Config.Checksum，为空表示不校验
+func checkChecksumAlgorithm(algorithm string) error {
+	if algorithm == "" {
+		return nil
+	}
+	_, err := newChecksumHash(algorithm)
+	return err
+}
+
+// 读取 r 计算 base64 编码的 MD5，algorithm 不为空时同时计算十六进制编码的整个对象的校验值
+func computeChecksum(r io.Reader, algorithm string) (contentMD5, checksum string, err error) {
+	var (
+		md5Hash = md5.New()
+		sum     hash.Hash
+		w       io.Writer = md5Hash
+	)
+	if algorithm != "" && algorithm != ChecksumMD5 {
+		if sum, err = newChecksumHash(algorithm); err != nil {
+			return "", "", err
+		}
+		w = io.MultiWriter(md5Hash, sum)
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		return "", "", err
+	}
+
+	md5Sum := md5Hash.Sum(nil)
+	contentMD5 = base64.StdEncoding.EncodeToString(md5Sum)
+	switch {
+	case sum != nil:
+		checksum = hex.EncodeToString(sum.Sum(nil))
+	case algorithm == ChecksumMD5:
+		checksum = hex.EncodeToString(md5Sum)
+	}
+	return contentMD5, checksum, nil
+}
+
+// 保存整个对象校验值的元数据
+func checksumMetadata(algorithm, checksum string) map[string]string {
+	return map[string]string{checksumMetadataPrefix + algorithm: checksum}
+}
+
+// 比较服务端返回的 ETag 与请求的 Content-MD5，二者都不为空且不同时返回 ErrChecksumMismatch
+func checkETag(etag, contentMD5 string) error {
+	etag = strings.Trim(etag, `"`)
+	if etag == "" || contentMD5 == "" {
+		return nil
+	}
+	sum, err := base64.StdEncoding.DecodeString(contentMD5)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(etag, hex.EncodeToString(sum)) {
+		return fmt.Errorf("etag %s does not match content md5 %s: %w", etag, contentMD5, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// 对象的校验算法和期望的校验值，优先使用元数据中保存的校验值，
+// 没有时单段上传的对象使用 ETag 中的 MD5，分片上传的对象无法校验
+func expectedChecksum(entry *Entry) (algorithm, checksum string, ok bool) {
+	for _, algorithm := range []string{ChecksumSHA256, ChecksumCRC64, ChecksumMD5} {
+		if checksum := entry.Metadata[checksumMetadataPrefix+algorithm]; checksum != "" {
+			return algorithm, strings.ToLower(checksum), true
+		}
+	}
+	if etag, ok := etagMD5(entry); ok {
+		return ChecksumMD5, etag, true
+	}
+	return "", "", false
+}
+
+// 单段上传的对象 ETag 即内容的 MD5，分片上传的对象 ETag 不是 MD5
+func etagMD5(entry *Entry) (string, bool) {
+	etag := strings.Trim(entry.Hash, `"`)
+	if _, err := hex.DecodeString(etag); err != nil || len(etag) != 2*md5.Size {
+		return "", false
+	}
+	return strings.ToLower(etag), true
+}
+
+// 两个对象是否可以确认内容相同：大小相同，且有同一算法的校验值并且相等。
+// 校验值来自元数据和单段上传的 ETag，没有可比较的校验值时返回 false
+func sameContent(a, b *Entry) bool {
+	if a.Fsize != b.Fsize {
+		return false
+	}
+	checksums := func(entry *Entry, algorithm string) string {
+		if checksum := entry.Metadata[checksumMetadataPrefix+algorithm]; checksum != "" {
+			return strings.ToLower(checksum)
+		}
+		if algorithm == ChecksumMD5 {
+			etag, _ := etagMD5(entry)
+			return etag
+		}
+		return ""
+	}
+	for _, algorithm := range []string{ChecksumSHA256, ChecksumCRC64, ChecksumMD5} {
+		x, y := checksums(a, algorithm), checksums(b, algorithm)
+		if x != "" && y != "" {
+			return x == y
+		}
+	}
+	return false
+}
+
+// 读取 r 校验下载的数据，对象没有可用的校验值时跳过
+func verifyChecksum(entry *Entry, r io.Reader) error {
+	algorithm, want, ok := expectedChecksum(entry)
+	if !ok {
+		return nil
+	}
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(h, r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("%s %s does not match %s: %w", algorithm, got, want, ErrChecksumMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum_Compute(t *testing.T) {
+	data := []byte("123456789")
+	testCases := map[string]string{
+		ChecksumMD5:    "25f9e794323b453885f5181f1b624d0b",
+		ChecksumSHA256: "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225",
+		ChecksumCRC64:  "995dc9bbdf1939fa",
+	}
+	for algorithm, expected := range testCases {
+		contentMD5, checksum, err := computeChecksum(bytes.NewReader(data), algorithm)
+		assert.NoError(t, err)
+		assert.Equal(t, "JfnnlDI7RTiF9RgfG2JNCw==", contentMD5)
+		assert.Equal(t, expected, checksum, algorithm)
+		assert.NoError(t, verifyChecksum(&Entry{Metadata: checksumMetadata(algorithm, checksum)}, bytes.NewReader(data)))
+	}
+
+	_, checksum, err := computeChecksum(bytes.NewReader(data), "")
+	assert.NoError(t, err)
+	assert.Empty(t, checksum)
+	assert.Error(t, checkChecksumAlgorithm("sha1"))
+}
+
+func TestChecksum_Expected(t *testing.T) {
+	type TestCase struct {
+		entry     Entry
+		algorithm string
+		ok        bool
+	}
+	testCases := []TestCase{
+		{entry: Entry{Hash: `"25f9e794323b453885f5181f1b624d0b"`}, algorithm: ChecksumMD5, ok: true},
+		// 分片上传的对象
+		{entry: Entry{Hash: `"25f9e794323b453885f5181f1b624d0b-2"`}},
+		{entry: Entry{Hash: `"25f9e794323b453885f5181f1b624d0b-2"`, Metadata: map[string]string{"checksum-crc64": "995dc9bbdf1939fa"}}, algorithm: ChecksumCRC64, ok: true},
+		{entry: Entry{Hash: "not-md5"}},
+	}
+	for _, tc := range testCases {
+		algorithm, _, ok := expectedChecksum(&tc.entry)
+		assert.Equal(t, tc.ok, ok)
+		assert.Equal(t, tc.algorithm, algorithm)
+	}
+
+	err := verifyChecksum(&Entry{Hash: `"25f9e794323b453885f5181f1b624d0b"`}, bytes.NewReader([]byte("12345678")))
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+}
+
+func TestChecksum_CheckETag(t *testing.T) {
+	assert.NoError(t, checkETag(`"25F9E794323B453885F5181F1B624D0B"`, "JfnnlDI7RTiF9RgfG2JNCw=="))
+	assert.NoError(t, checkETag("", "JfnnlDI7RTiF9RgfG2JNCw=="))
+	assert.NoError(t, checkETag(`"25f9e794323b453885f5181f1b624d0b"`, ""))
+	assert.True(t, errors.Is(checkETag(`"d41d8cd98f00b204e9800998ecf8427e"`, "JfnnlDI7RTiF9RgfG2JNCw=="), ErrChecksumMismatch))
+}
+
+func TestChecksum_UploadDownload(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	for _, algorithm := range []string{ChecksumMD5, ChecksumSHA256, ChecksumCRC64} {
+		backend := NewMemoryBackend()
+		config := &Config{Backend: backend, PartSize: 4, MultipartThreshold: 1, Checksum: algorithm}
+		uploader, err := NewUploader(config)
+		assert.NoError(t, err)
+		downloader, err := NewDownloader(config)
+		assert.NoError(t, err)
+
+		file, data := newCheckpointTestFile(t, 2*partSize+10)
+		assert.NoError(t, uploader.UploadData(data[:10], "small"))
+		assert.NoError(t, uploader.Upload(file, "multipart"))
+		config.CheckpointStore = NewLocalCheckpointStore(t.TempDir())
+		uploader, err = NewUploader(config)
+		assert.NoError(t, err)
+		assert.NoError(t, uploader.Upload(file, "checkpoint"))
+
+		for _, key := range []string{"small", "multipart", "checkpoint"} {
+			entry, err := backend.HeadObject(context.Background(), key)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, entry.Metadata[checksumMetadataPrefix+algorithm], key)
+
+			expected := data
+			if key == "small" {
+				expected = data[:10]
+			}
+			downloaded, err := downloader.DownloadBytes(key)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, downloaded)
+			f, err := downloader.DownloadFile(key, filepath.Join(t.TempDir(), key))
+			assert.NoError(t, err)
+			f.Close()
+		}
+	}
+
+	_, err := NewUploader(&Config{Backend: NewMemoryBackend(), Checksum: "sha1"})
+	assert.Error(t, err)
+	_, err = NewDownloader(&Config{Backend: NewMemoryBackend(), Checksum: "sha1"})
+	assert.Error(t, err)
+}
+
+func TestChecksum_StoredCorruption(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	backend := NewMemoryBackend()
+	config := &Config{Backend: backend, PartSize: 4, MultipartThreshold: 1, Checksum: ChecksumSHA256, RetryPolicy: fastRetryPolicy(2)}
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+
+	// 保留元数据，替换对象的内容
+	file, data := newCheckpointTestFile(t, 2*partSize+10)
+	assert.NoError(t, uploader.Upload(file, "key"))
+	entry, err := backend.HeadObject(context.Background(), "key")
+	assert.NoError(t, err)
+	data[partSize] ^= 0xff
+	assert.NoError(t, backend.PutObject(context.Background(), "key", bytes.NewReader(data), int64(len(data)), &PutOptions{Metadata: entry.Metadata}))
+
+	_, err = downloader.DownloadBytes("key")
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+	path := filepath.Join(t.TempDir(), "file")
+	_, err = downloader.DownloadFile("key", path)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	for _, name := range []string{path, downloadCheckpointPath(path), downloadTempPath(path)} {
+		_, err = os.Stat(name)
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	// 没有启用校验时不检查
+	downloader, err = NewDownloader(&Config{Backend: backend})
+	assert.NoError(t, err)
+	downloaded, err := downloader.DownloadBytes("key")
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+}
+
+// 下载时损坏前 corruptions 次返回的数据
+type corruptBackend struct {
+	Backend
+
+	mu          sync.Mutex
+	corruptions int
+}
+
+func (b *corruptBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	output, err := b.Backend.GetObject(ctx, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.corruptions > 0 {
+		b.corruptions--
+		data, err := io.ReadAll(output.Body)
+		output.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		data[0] ^= 0xff
+		output.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return output, nil
+}
+
+func TestChecksum_TransferCorruption(t *testing.T) {
+	backend := &corruptBackend{Backend: NewMemoryBackend()}
+	config := &Config{Backend: backend, Checksum: ChecksumCRC64, RetryPolicy: fastRetryPolicy(2)}
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	assert.NoError(t, uploader.UploadData([]byte("0123456789"), "key"))
+
+	// 校验不一致时重试
+	backend.corruptions = 1
+	data, err := downloader.DownloadBytes("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+	assert.Equal(t, 0, backend.corruptions)
+
+	backend.corruptions = 2
+	_, err = downloader.DownloadBytes("key")
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+}
@@ -0,0 +1,501 @@
+package operation
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// 块缓存的默认参数
+const (
+	defaultCacheBlockSize      = 1024 * 1024
+	defaultCacheMemoryCapacity = 64 * 1024 * 1024
+	defaultCacheDiskCapacity   = 1024 * 1024 * 1024
+	defaultCacheReadAhead      = 4
+	defaultCacheObjectTTL      = time.Minute
+	defaultCacheFetchTimeout   = time.Minute
+)
+
+// 缓存的对象元信息和读取位置的条目数上限
+const cacheMaxObjects = 10000
+
+// BlockCacheConfig 范围读取的块缓存配置。对象按 BlockSize 对齐分块下载，块按对象的 ETag 区分版本，
+// 下载的块同时写入内存和磁盘缓存，各自按容量以 LRU 淘汰；并发读取同一个块时只下载一次
+type BlockCacheConfig struct {
+	// BlockSize 块大小（字节），默认 1 MiB
+	BlockSize int64
+	// MemoryCapacity 内存缓存的容量（字节），默认 64 MiB
+	MemoryCapacity int64
+	// DiskDir 磁盘缓存的目录，为空时只使用内存缓存；重启后保留已缓存的块，不能被多个下载器共用
+	DiskDir string
+	// DiskCapacity 磁盘缓存的容量（字节），默认 1 GiB
+	DiskCapacity int64
+	// ReadAhead 检测到顺序读取时预读的块数，默认 4，为负数时不预读
+	ReadAhead int
+	// ObjectTTL DownloadRangeBytes 缓存对象 ETag 和大小的时长，默认 1 分钟，
+	// 过期后重新获取元信息；对象在此期间被覆盖时可能读到旧的数据
+	ObjectTTL time.Duration
+	// FetchTimeout 共享的下载块和获取元信息请求的超时时间，默认 1 分钟。
+	// 这些请求不随发起的读取取消，超时后释放，之后的读取重新发起
+	FetchTimeout time.Duration
+}
+
+// 缓存的对象版本，etag 为获取元信息的副本上的 ETag，用于区分缓存的块
+type cachedObject struct {
+	key     string
+	etag    string
+	size    int64
+	version *objectVersion
+	expires time.Time
+}
+
+// 下载对象 [offset, offset+size) 范围的块，readAhead 表示是否为预读
+type blockFetcher func(ctx context.Context, obj *cachedObject, offset, size int64, readAhead bool) ([]byte, error)
+
+type blockCache struct {
+	bucket      string
+	blockSize   int64
+	readAhead   int
+	objectTTL   time.Duration
+	timeout     time.Duration
+	concurrency int
+	dir         string
+
+	group   singleflight.Group
+	mu      sync.Mutex
+	memory  *lruCache
+	disk    *lruCache // 磁盘缓存的文件名，为空时不使用磁盘缓存
+	objects *lruCache // DownloadRangeBytes 使用的对象元信息
+	reads   *lruCache // 每个对象上一次读取的结束位置，用于检测顺序读取
+}
+
+// 补全未设置的字段，加载磁盘缓存目录中已有的块
+func newBlockCache(c *BlockCacheConfig, bucket string, concurrency int) (*blockCache, error) {
+	config := *c
+	if config.BlockSize <= 0 {
+		config.BlockSize = defaultCacheBlockSize
+	}
+	if config.MemoryCapacity <= 0 {
+		config.MemoryCapacity = defaultCacheMemoryCapacity
+	}
+	if config.DiskCapacity <= 0 {
+		config.DiskCapacity = defaultCacheDiskCapacity
+	}
+	if config.ReadAhead == 0 {
+		config.ReadAhead = defaultCacheReadAhead
+	}
+	if config.ObjectTTL <= 0 {
+		config.ObjectTTL = defaultCacheObjectTTL
+	}
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = defaultCacheFetchTimeout
+	}
+
+	cache := &blockCache{
+		bucket:      bucket,
+		blockSize:   config.BlockSize,
+		readAhead:   config.ReadAhead,
+		objectTTL:   config.ObjectTTL,
+		timeout:     config.FetchTimeout,
+		concurrency: concurrency,
+		dir:         config.DiskDir,
+		memory:      newLRUCache(config.MemoryCapacity),
+		objects:     newLRUCache(cacheMaxObjects),
+		reads:       newLRUCache(cacheMaxObjects),
+	}
+	if cache.dir != "" {
+		cache.disk = newLRUCache(config.DiskCapacity)
+		if err := cache.loadDisk(); err != nil {
+			return nil, err
+		}
+	}
+	return cache, nil
+}
+
+// 按修改时间从旧到新加入磁盘缓存，删除上次退出时遗留的临时文件和超出容量的块
+func (c *blockCache) loadDisk() error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var files []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			os.Remove(filepath.Join(c.dir, entry.Name()))
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files {
+		c.removeFiles(c.disk.add(info.Name(), nil, info.Size()))
+	}
+	return nil
+}
+
+func (c *blockCache) removeFiles(evicted []*lruEntry) {
+	for _, entry := range evicted {
+		os.Remove(filepath.Join(c.dir, entry.key))
+	}
+}
+
+// 块在缓存中的 key，包含块大小，修改 BlockSize 后不会读到按旧的大小切分的块
+func (c *blockCache) blockKey(obj *cachedObject, index int64) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%d\x00%d", c.bucket, obj.key, obj.etag, c.blockSize, index)
+}
+
+// 块在磁盘缓存中的文件名
+func diskBlockName(blockKey string) string {
+	sum := sha256.Sum256([]byte(blockKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// 第 index 块的范围
+func (c *blockCache) blockRange(obj *cachedObject, index int64) (offset, size int64) {
+	offset = index * c.blockSize
+	size = obj.size - offset
+	if size > c.blockSize {
+		size = c.blockSize
+	}
+	return offset, size
+}
+
+// 未过期的对象元信息
+func (c *blockCache) object(key string) (*cachedObject, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.objects.get(key)
+	if !ok {
+		return nil, false
+	}
+	obj := value.(*cachedObject)
+	if time.Now().After(obj.expires) {
+		c.objects.remove(key)
+		return nil, false
+	}
+	return obj, true
+}
+
+func (c *blockCache) putObject(key string, v *objectVersion) *cachedObject {
+	obj := &cachedObject{key: key, etag: v.entry.Hash, size: v.entry.Fsize, version: v, expires: time.Now().Add(c.objectTTL)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects.add(key, obj, 1)
+	return obj
+}
+
+// 对象被覆盖后丢弃元信息，旧版本的块不会再被读到，由 LRU 淘汰
+func (c *blockCache) forgetObject(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects.remove(key)
+}
+
+// 读取对象 [off, off+len(p)) 范围的数据，范围不能超出对象，缺少的块用 fetch 下载。
+// 下载在后台进行，ctx 取消时立即返回，已开始的下载完成后仍写入缓存
+func (c *blockCache) readAt(ctx context.Context, obj *cachedObject, p []byte, off int64, fetch blockFetcher) error {
+	if len(p) == 0 {
+		return nil
+	}
+	end := off + int64(len(p))
+	first, last := off/c.blockSize, (end-1)/c.blockSize
+	if c.sequential(obj, off, end) {
+		for index := last + 1; index <= last+int64(c.readAhead) && index*c.blockSize < obj.size; index++ {
+			c.load(ctx, obj, index, fetch, true)
+		}
+	}
+
+	for start := first; start <= last; start += int64(c.concurrency) {
+		var results []<-chan singleflight.Result
+		for index := start; index <= last && index < start+int64(c.concurrency); index++ {
+			results = append(results, c.load(ctx, obj, index, fetch, false))
+		}
+		for i, result := range results {
+			var res singleflight.Result
+			select {
+			case res = <-result:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if res.Err != nil {
+				return res.Err
+			}
+			blockOffset, _ := c.blockRange(obj, start+int64(i))
+			copyBlock(p, off, res.Val.([]byte), blockOffset)
+		}
+	}
+	return nil
+}
+
+// 把从 blockOffset 开始的块中与 [off, off+len(p)) 重叠的部分复制到 p
+func copyBlock(p []byte, off int64, block []byte, blockOffset int64) {
+	if blockOffset >= off {
+		copy(p[blockOffset-off:], block)
+	} else {
+		copy(p, block[off-blockOffset:])
+	}
+}
+
+// 记录读取的结束位置，本次读取紧接上一次读取时为顺序读取
+func (c *blockCache) sequential(obj *cachedObject, off, end int64) bool {
+	if c.readAhead < 0 {
+		return false
+	}
+	id := obj.key + "\x00" + obj.etag
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, ok := c.reads.get(id)
+	c.reads.add(id, end, 1)
+	return ok && prev.(int64) == off
+}
+
+// 获取第 index 块，依次查找内存缓存、磁盘缓存，都没有时下载；同一个块同时只有一个加载
+func (c *blockCache) load(ctx context.Context, obj *cachedObject, index int64, fetch blockFetcher, readAhead bool) <-chan singleflight.Result {
+	key := c.blockKey(obj, index)
+	c.mu.Lock()
+	block, ok := c.memory.get(key)
+	c.mu.Unlock()
+	if ok {
+		result := make(chan singleflight.Result, 1)
+		result <- singleflight.Result{Val: block}
+		return result
+	}
+
+	return c.group.DoChan(key, func() (interface{}, error) {
+		offset, size := c.blockRange(obj, index)
+		if block, ok := c.readDisk(key, size); ok {
+			c.putMemory(key, block)
+			return block, nil
+		}
+		ctx, cancel := c.shared(ctx)
+		defer cancel()
+		block, err := fetch(ctx, obj, offset, size, readAhead)
+		if err != nil {
+			return nil, err
+		}
+		c.putMemory(key, block)
+		c.writeDisk(key, block)
+		return block, nil
+	})
+}
+
+// 由多个读取共享的请求使用的上下文，保留 ctx 中的值，不随发起请求的读取取消，但有超时时间
+func (c *blockCache) shared(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{ctx}, c.timeout)
+}
+
+func (c *blockCache) putMemory(key string, block []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.memory.add(key, block, int64(len(block)))
+}
+
+// 从磁盘缓存读取块，文件不存在或大小不对时视为未缓存
+func (c *blockCache) readDisk(key string, size int64) ([]byte, bool) {
+	if c.disk == nil {
+		return nil, false
+	}
+	name := diskBlockName(key)
+	c.mu.Lock()
+	_, ok := c.disk.get(name)
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	block, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err == nil && int64(len(block)) == size {
+		return block, true
+	}
+	c.mu.Lock()
+	c.disk.remove(name)
+	c.mu.Unlock()
+	os.Remove(filepath.Join(c.dir, name))
+	return nil, false
+}
+
+// 写入磁盘缓存，写入失败时只使用内存缓存
+func (c *blockCache) writeDisk(key string, block []byte) {
+	if c.disk == nil {
+		return
+	}
+	name := diskBlockName(key)
+	if err := writeFileAtomic(filepath.Join(c.dir, name), block); err != nil {
+		return
+	}
+	c.mu.Lock()
+	evicted := c.disk.add(name, nil, int64(len(block)))
+	c.mu.Unlock()
+	c.removeFiles(evicted)
+}
+
+// 从块缓存读取范围，缓存的元信息过期前对象被覆盖时重新获取一次元信息
+func (d *singleClusterDownloader) cachedRangeBytes(ctx context.Context, log *fieldLogger, key string, offset, size int64) (int64, []byte, error) {
+	for restarted := false; ; restarted = true {
+		obj, err := d.cachedObject(ctx, log, key)
+		if err != nil {
+			return -1, nil, err
+		}
+		start, end, ok := resolveRange(&Range{Offset: offset, Size: size}, obj.size)
+		if !ok {
+			return -1, nil, newObsError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range cannot be satisfied.")
+		}
+		data := make([]byte, end-start)
+		err = d.cache.readAt(ctx, obj, data, start, d.downloadBlock)
+		if errors.Is(err, ErrPreconditionFailed) && !restarted {
+			d.cache.forgetObject(key)
+			continue
+		}
+		if err != nil {
+			return -1, nil, err
+		}
+		return end - start, data, nil
+	}
+}
+
+// 对象的元信息，缓存过期时重新获取，同一个对象同时只获取一次。
+// 获取由多个读取共享，不随发起的读取取消，ctx 取消时只有当前读取返回
+func (d *singleClusterDownloader) cachedObject(ctx context.Context, log *fieldLogger, key string) (*cachedObject, error) {
+	if obj, ok := d.cache.object(key); ok {
+		return obj, nil
+	}
+	result := d.cache.group.DoChan("head\x00"+key, func() (interface{}, error) {
+		ctx, cancel := d.cache.shared(ctx)
+		defer cancel()
+		v, err := d.replicas.head(ctx, log, key)
+		if err != nil {
+			return nil, err
+		}
+		return d.cache.putObject(key, v), nil
+	})
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*cachedObject), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 下载块缓存缺少的块，只在各副本上的对象仍为缓存的版本时下载
+func (d *singleClusterDownloader) downloadBlock(ctx context.Context, obj *cachedObject, offset, size int64, readAhead bool) (block []byte, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownloadBlock, "key", obj.key, "offset", offset, "size", size, "read_ahead", readAhead)
+	defer func() {
+		op.end(int64(len(block)), err)
+	}()
+
+	err = d.replicas.doVersion(ctx, op.log, obj.version, func(ctx context.Context, backend Backend, etag string) error {
+		output, err := backend.GetObject(ctx, obj.key, &GetOptions{Range: &Range{Offset: offset, Size: size}, IfMatch: etag})
+		if err != nil {
+			return err
+		}
+		defer output.Body.Close()
+		block = make([]byte, size)
+		if _, err = io.ReadFull(output.Body, block); err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	})
+	if err != nil {
+		block = nil
+	}
+	return
+}
+
+// 保留 ctx 中的值（如 span），但不随 ctx 取消
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// 按最近使用的顺序淘汰的缓存，超出容量时淘汰最久未使用的条目，容量和大小的单位由调用方决定，不加锁
+type lruCache struct {
+	capacity int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+func newLRUCache(capacity int64) *lruCache {
+	return &lruCache{capacity: capacity, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// 加入或替换条目，返回被淘汰的条目，大小超过容量的条目会被立即淘汰
+func (c *lruCache) add(key string, value interface{}, size int64) (evicted []*lruEntry) {
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		c.size += size - entry.size
+		entry.value, entry.size = value, size
+		c.ll.MoveToFront(elem)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, size: size})
+		c.size += size
+	}
+	for c.size > c.capacity {
+		entry := c.ll.Remove(c.ll.Back()).(*lruEntry)
+		delete(c.items, entry.key)
+		c.size -= entry.size
+		evicted = append(evicted, entry)
+	}
+	return evicted
+}
+
+func (c *lruCache) remove(key string) {
+	if elem, ok := c.items[key]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+		c.size -= elem.Value.(*lruEntry).size
+	}
+}
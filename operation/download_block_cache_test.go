@@ -0,0 +1,305 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (b *rangeBackend) getCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gets
+}
+
+func newBlockCacheTest(t *testing.T, size int, cache *BlockCacheConfig) (*rangeBackend, []byte, *Downloader) {
+	backend := &rangeBackend{Backend: NewMemoryBackend()}
+	data := newRangeTestObject(t, backend, size)
+	downloader, err := NewDownloader(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(2), BlockCache: cache})
+	assert.NoError(t, err)
+	return backend, data, downloader
+}
+
+func TestBlockCache_RangeBytes(t *testing.T) {
+	backend, data, downloader := newBlockCacheTest(t, 100, &BlockCacheConfig{BlockSize: 16, ReadAhead: -1})
+
+	type TestCase struct {
+		offset   int64
+		size     int64
+		expected []byte
+		gets     int
+	}
+	testCases := []TestCase{
+		{offset: 0, size: 10, expected: data[:10], gets: 1},
+		{offset: 4, size: 8, expected: data[4:12], gets: 0},
+		// 跨越多个块
+		{offset: 10, size: 40, expected: data[10:50], gets: 3},
+		{offset: -1, size: 4, expected: data[96:], gets: 1},
+		{offset: 90, size: -1, expected: data[90:], gets: 1},
+		{offset: 60, size: 1000, expected: data[60:], gets: 1},
+		{offset: 0, size: 100, expected: data, gets: 0},
+	}
+	for _, tc := range testCases {
+		gets := backend.getCount()
+		l, downloaded, err := downloader.DownloadRangeBytes("key", tc.offset, tc.size)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(tc.expected)), l)
+		assert.Equal(t, tc.expected, downloaded)
+		assert.Equal(t, tc.gets, backend.getCount()-gets, "offset %d size %d", tc.offset, tc.size)
+	}
+
+	_, _, err := downloader.DownloadRangeBytes("key", 100, 4)
+	assert.True(t, errors.Is(err, ErrRangeNotSatisfiable))
+	_, _, err = downloader.DownloadRangeBytes("not-exist", 0, 4)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestBlockCache_Singleflight(t *testing.T) {
+	backend, data, downloader := newBlockCacheTest(t, 100, &BlockCacheConfig{BlockSize: 64, ReadAhead: -1})
+	// 先获取对象的元信息
+	_, _, err := downloader.DownloadRangeBytes("key", 80, 4)
+	assert.NoError(t, err)
+	backend.onGet = func(opts *GetOptions) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, downloaded, err := downloader.DownloadRangeBytes("key", int64(i), 4)
+			assert.NoError(t, err)
+			assert.Equal(t, data[i:i+4], downloaded)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 2, backend.getCount())
+}
+
+func TestBlockCache_ReadAhead(t *testing.T) {
+	backend, data, downloader := newBlockCacheTest(t, 64, &BlockCacheConfig{BlockSize: 16, ReadAhead: 2})
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	defer r.Close()
+
+	p := make([]byte, 16)
+	_, err = r.ReadAt(p, 0)
+	assert.NoError(t, err)
+	// 随机读取不预读
+	_, err = r.ReadAt(p, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, backend.getCount())
+
+	// 顺序读取时预读之后的两块
+	_, err = r.ReadAt(p, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, data[16:32], p)
+	assert.Eventually(t, func() bool {
+		return backend.getCount() == 4
+	}, time.Second, time.Millisecond)
+
+	p = make([]byte, 32)
+	_, err = r.ReadAt(p, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, data[32:], p)
+	assert.Equal(t, 4, backend.getCount())
+}
+
+func TestBlockCache_Disk(t *testing.T) {
+	dir := t.TempDir()
+	config := &BlockCacheConfig{BlockSize: 16, MemoryCapacity: 16, DiskDir: dir, DiskCapacity: 48, ReadAhead: -1}
+	backend, data, downloader := newBlockCacheTest(t, 64, config)
+	for offset := 0; offset < 64; offset += 16 {
+		_, downloaded, err := downloader.DownloadRangeBytes("key", int64(offset), 16)
+		assert.NoError(t, err)
+		assert.Equal(t, data[offset:offset+16], downloaded)
+	}
+	assert.Equal(t, 4, backend.getCount())
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	// 重新创建的下载器从磁盘读取淘汰出内存的块，第一块已从磁盘淘汰
+	downloader, err = NewDownloader(&Config{Backend: backend, BlockCache: config})
+	assert.NoError(t, err)
+	_, downloaded, err := downloader.DownloadRangeBytes("key", 16, 48)
+	assert.NoError(t, err)
+	assert.Equal(t, data[16:], downloaded)
+	assert.Equal(t, 4, backend.getCount())
+	_, downloaded, err = downloader.DownloadRangeBytes("key", 0, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:16], downloaded)
+	assert.Equal(t, 5, backend.getCount())
+
+	// 修改块大小后不使用按旧的大小切分的块
+	downloader, err = NewDownloader(&Config{Backend: backend, BlockCache: &BlockCacheConfig{BlockSize: 32, DiskDir: dir}})
+	assert.NoError(t, err)
+	_, downloaded, err = downloader.DownloadRangeBytes("key", 32, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, data[32:], downloaded)
+	assert.Equal(t, 6, backend.getCount())
+}
+
+func TestBlockCache_ObjectChanged(t *testing.T) {
+	backend, data, downloader := newBlockCacheTest(t, 32, &BlockCacheConfig{BlockSize: 16, ReadAhead: -1})
+	_, downloaded, err := downloader.DownloadRangeBytes("key", 0, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:4], downloaded)
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	defer r.Close()
+
+	// 打开后对象被覆盖，读取已缓存的块返回打开时的数据，读取未缓存的块返回 ErrPreconditionFailed
+	changed := bytes.Repeat([]byte("x"), 40)
+	assert.NoError(t, backend.PutObject(context.Background(), "key", bytes.NewReader(changed), int64(len(changed)), nil))
+	p := make([]byte, 4)
+	_, err = r.ReadAt(p, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:4], p)
+	_, err = r.ReadAt(p, 20)
+	assert.True(t, errors.Is(err, ErrPreconditionFailed))
+
+	// DownloadRangeBytes 读取未缓存的块时重新获取元信息
+	l, downloaded, err := downloader.DownloadRangeBytes("key", 16, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(24), l)
+	assert.Equal(t, changed[16:], downloaded)
+	_, downloaded, err = downloader.DownloadRangeBytes("key", 0, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, changed[:4], downloaded)
+}
+
+func TestBlockCache_Canceled(t *testing.T) {
+	backend, data, downloader := newBlockCacheTest(t, 32, &BlockCacheConfig{BlockSize: 16, ReadAhead: -1})
+	_, _, err := downloader.DownloadRangeBytes("key", 0, 4)
+	assert.NoError(t, err)
+	backend.onGet = func(opts *GetOptions) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// 取消的读取不影响进行中的下载，下载完成后写入缓存
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = downloader.DownloadRangeBytesContext(ctx, "key", 16, 4)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	_, downloaded, err := downloader.DownloadRangeBytes("key", 16, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, data[16:20], downloaded)
+	assert.Equal(t, 2, backend.getCount())
+}
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(10)
+	assert.Empty(t, c.add("a", 1, 4))
+	assert.Empty(t, c.add("b", 2, 4))
+	_, ok := c.get("a")
+	assert.True(t, ok)
+
+	// 淘汰最久未使用的条目
+	evicted := c.add("c", 3, 4)
+	assert.Len(t, evicted, 1)
+	assert.Equal(t, "b", evicted[0].key)
+
+	// 替换条目时更新大小
+	assert.Empty(t, c.add("a", 4, 2))
+	value, ok := c.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 4, value)
+	assert.Equal(t, int64(6), c.size)
+
+	c.remove("c")
+	_, ok = c.get("c")
+	assert.False(t, ok)
+	assert.Equal(t, int64(2), c.size)
+
+	// 超过容量的条目被立即淘汰
+	evicted = c.add("d", 5, 20)
+	assert.Len(t, evicted, 2)
+	assert.Equal(t, int64(0), c.size)
+}
+
+// hangHead、hangGet 不为 0 时请求阻塞到 ctx 结束的存储后端，获取元信息在关闭 release 后继续
+type hangingBackend struct {
+	Backend
+	hangHead int32
+	hangGet  int32
+	release  chan struct{}
+}
+
+func (b *hangingBackend) HeadObject(ctx context.Context, key string) (*Entry, error) {
+	if atomic.LoadInt32(&b.hangHead) != 0 {
+		select {
+		case <-b.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return b.Backend.HeadObject(ctx, key)
+}
+
+func (b *hangingBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	if atomic.LoadInt32(&b.hangGet) != 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return b.Backend.GetObject(ctx, key, opts)
+}
+
+func TestBlockCache_FetchTimeout(t *testing.T) {
+	backend := &hangingBackend{Backend: NewMemoryBackend()}
+	data := newRangeTestObject(t, backend, 32)
+	downloader, err := NewDownloader(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(1), BlockCache: &BlockCacheConfig{BlockSize: 16, ReadAhead: -1, FetchTimeout: 20 * time.Millisecond}})
+	assert.NoError(t, err)
+
+	// 没有单次尝试超时时，共享的下载在 FetchTimeout 后结束并释放
+	atomic.StoreInt32(&backend.hangGet, 1)
+	_, _, err = downloader.DownloadRangeBytes("key", 0, 4)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	atomic.StoreInt32(&backend.hangGet, 0)
+	_, downloaded, err := downloader.DownloadRangeBytes("key", 0, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:4], downloaded)
+
+	atomic.StoreInt32(&backend.hangHead, 1)
+	downloader, err = NewDownloader(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(1), BlockCache: &BlockCacheConfig{BlockSize: 16, ReadAhead: -1, FetchTimeout: 20 * time.Millisecond}})
+	assert.NoError(t, err)
+	_, _, err = downloader.DownloadRangeBytes("key", 0, 4)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+}
+
+func TestBlockCache_SharedHead(t *testing.T) {
+	backend := &hangingBackend{Backend: NewMemoryBackend()}
+	data := newRangeTestObject(t, backend, 32)
+	downloader, err := NewDownloader(&Config{Backend: backend, BlockCache: &BlockCacheConfig{BlockSize: 16, ReadAhead: -1}})
+	assert.NoError(t, err)
+
+	// 发起获取元信息的读取取消后，等待同一次获取的其余读取不受影响
+	backend.release = make(chan struct{})
+	atomic.StoreInt32(&backend.hangHead, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, _, err := downloader.DownloadRangeBytesContext(ctx, "key", 0, 4)
+		canceled <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	waiting := make(chan []byte, 1)
+	go func() {
+		_, downloaded, err := downloader.DownloadRangeBytes("key", 0, 4)
+		assert.NoError(t, err)
+		waiting <- downloaded
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.True(t, errors.Is(<-canceled, context.Canceled))
+	close(backend.release)
+	assert.Equal(t, data[:4], <-waiting)
+}
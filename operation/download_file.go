@@ -0,0 +1,212 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 下载文件的断点，与目标文件并列保存为 <path>.checkpoint，
+// 已下载的数据保存在临时文件 <path>.download，全部完成后重命名为目标文件
+type downloadCheckpoint struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// ETag、Size、LastModified 记录下载的对象版本，对象变化或分段大小变化时断点失效
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	PartSize     int64     `json:"part_size"`
+	// Parts 已完成的分段号，从 1 开始
+	Parts []int `json:"parts"`
+}
+
+func downloadCheckpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+func downloadTempPath(path string) string {
+	return path + ".download"
+}
+
+// 断点是否对应同一个对象版本和分段方式
+func (cp *downloadCheckpoint) matches(other *downloadCheckpoint) bool {
+	return cp.Bucket == other.Bucket && cp.Key == other.Key && cp.ETag == other.ETag && cp.Size == other.Size &&
+		cp.LastModified.Equal(other.LastModified) && cp.PartSize == other.PartSize
+}
+
+// 读取目标文件的断点，不存在、无法解析或与当前下载不匹配时返回 nil
+func loadDownloadCheckpoint(log *fieldLogger, path string, want *downloadCheckpoint) *downloadCheckpoint {
+	data, err := os.ReadFile(downloadCheckpointPath(path))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.warn("load checkpoint failed", "error", err)
+		}
+		return nil
+	}
+	cp := &downloadCheckpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		log.warn("invalid checkpoint", "error", err)
+		return nil
+	}
+	if !cp.matches(want) {
+		log.debug("checkpoint does not match object")
+		return nil
+	}
+	// 断点存在但临时文件已被删除时重新下载
+	if _, err = os.Stat(downloadTempPath(path)); err != nil {
+		return nil
+	}
+	return cp
+}
+
+// 删除断点和临时文件，下一次下载从头开始
+func removeDownloadCheckpoint(log *fieldLogger, path string) {
+	for _, name := range []string{downloadCheckpointPath(path), downloadTempPath(path)} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.warn("delete checkpoint failed", "file", name, "error", err)
+		}
+	}
+}
+
+// 分段并发下载对象到临时文件，每个分段完成后保存一次断点，全部完成后重命名为目标文件并删除断点。
+// 没有可用的断点时清空临时文件重新下载，分段请求带上对象在各副本上的 ETag 作为 If-Match，
+// 对象在下载过程中变化时删除断点并返回 ErrPreconditionFailed。
+// 开启校验时在重命名前校验整个文件，不一致时删除断点并返回 ErrChecksumMismatch
+func (d *singleClusterDownloader) downloadRanges(ctx context.Context, log *fieldLogger, key, path string, v *objectVersion) (_ *os.File, err error) {
+	entry := v.entry
+	size := entry.Fsize
+	want := &downloadCheckpoint{Bucket: d.bucket, Key: key, ETag: entry.Hash, Size: size, LastModified: entry.PutTime, PartSize: d.partSize}
+	flag := os.O_CREATE | os.O_RDWR
+	cp := loadDownloadCheckpoint(log, path, want)
+	if cp != nil {
+		log.debug("resume download", "parts", len(cp.Parts))
+	} else {
+		cp = want
+		flag |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(downloadTempPath(path), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// 出错时关闭文件，已下载的分段留给下一次下载续传，对象已变化或校验不一致时不再保留
+	defer func() {
+		if err != nil {
+			f.Close()
+			if errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrChecksumMismatch) {
+				removeDownloadCheckpoint(log, path)
+			}
+		}
+	}()
+	if err = f.Truncate(size); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	save := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		data, err := json.Marshal(cp)
+		if err == nil {
+			err = writeFileAtomic(downloadCheckpointPath(path), data)
+		}
+		if err != nil {
+			log.warn("save checkpoint failed", "error", err)
+		}
+	}
+
+	var (
+		partCount = int((size + d.partSize - 1) / d.partSize)
+		completed = make(map[int]bool, len(cp.Parts))
+		pool      = NewGoroutinePool(d.downConcurrency)
+		skipped   int64
+	)
+	for _, partNumber := range cp.Parts {
+		completed[partNumber] = true
+	}
+	if partCount > 1 {
+		save()
+	}
+	spanFromContext(ctx).SetAttributes(Attribute{Key: "parts", Value: partCount})
+	for i := 0; i < partCount; i++ {
+		offset := int64(i) * d.partSize
+		partSize := d.partSize
+		if partSize > size-offset {
+			partSize = size - offset
+		}
+		if completed[i+1] {
+			skipped += partSize
+			continue
+		}
+
+		func(partNumber int, offset, partSize int64) {
+			pool.Go(func(ctx context.Context) error {
+				if err := d.downloadPart(ctx, log, key, v, f, partNumber, offset, partSize); err != nil {
+					return err
+				}
+				if partCount > 1 {
+					mu.Lock()
+					cp.Parts = append(cp.Parts, partNumber)
+					mu.Unlock()
+					save()
+				}
+				return nil
+			})
+		}(i+1, offset, partSize)
+	}
+	// 续传时已完成的分段计入进度
+	progressFromContext(ctx).reset(skipped, size)
+	if err = pool.Wait(ctx); err != nil {
+		return nil, err
+	}
+	if d.verify {
+		if err = verifyChecksum(entry, io.NewSectionReader(f, 0, size)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 关闭后再重命名，之后重新打开目标文件返回给调用方
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(downloadTempPath(path), path); err != nil {
+		return nil, err
+	}
+	removeDownloadCheckpoint(log, path)
+	return os.OpenFile(path, os.O_RDWR, 0644)
+}
+
+// 下载一个分段并写入文件的对应位置，重试或切换副本时重新下载整个分段。
+// 只在各副本上的对象仍为版本 v 时下载，读取的长度不足时返回 io.ErrUnexpectedEOF
+func (d *singleClusterDownloader) downloadPart(ctx context.Context, log *fieldLogger, key string, v *objectVersion, f io.WriterAt, partNumber int, offset, size int64) (err error) {
+	ctx, span := d.telemetry.span(ctx, "download_part", "key", key, "part", partNumber, "offset", offset, "size", size)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	err = d.replicas.doVersion(ctx, log.with("part", partNumber), v, func(ctx context.Context, backend Backend, etag string) error {
+		output, err := backend.GetObject(ctx, key, &GetOptions{Range: &Range{Offset: offset, Size: size}, IfMatch: etag})
+		if err != nil {
+			return err
+		}
+		defer output.Body.Close()
+
+		return trackBody(ctx, output.Body, func(body io.Reader) error {
+			n, err := io.CopyN(&offsetWriter{w: f, offset: offset}, body, size)
+			if err == io.EOF {
+				return fmt.Errorf("download length not equal, expected %d, got %d: %w", size, n, io.ErrUnexpectedEOF)
+			}
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	progressFromContext(ctx).partCompleted(partNumber)
+	return nil
+}
@@ -0,0 +1,85 @@
+package operation
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+)
+
+type multiClustersDownloader struct {
+	config      *MultiClustersConfig
+	downloaders []*singleClusterDownloader
+}
+
+func newMultiClustersDownloader(c *MultiClustersConfig) (*multiClustersDownloader, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	downloaders := make([]*singleClusterDownloader, len(c.Clusters))
+	for i, cluster := range c.Clusters {
+		downloader, err := newSingleClusterDownloader(cluster.Config)
+		if err != nil {
+			return nil, err
+		}
+		downloaders[i] = downloader
+	}
+	return &multiClustersDownloader{config: c, downloaders: downloaders}, nil
+}
+
+func (d *multiClustersDownloader) forKey(key string) (*singleClusterDownloader, error) {
+	index, err := d.config.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.downloaders[index], nil
+}
+
+func (d *multiClustersDownloader) downloadRaw(ctx context.Context, key string, headers http.Header) (io.ReadCloser, error) {
+	downloader, err := d.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.downloadRaw(ctx, key, headers)
+}
+
+func (d *multiClustersDownloader) downloadFile(ctx context.Context, key, path string) (*os.File, error) {
+	downloader, err := d.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.downloadFile(ctx, key, path)
+}
+
+func (d *multiClustersDownloader) downloadBytes(ctx context.Context, key string) ([]byte, error) {
+	downloader, err := d.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.downloadBytes(ctx, key)
+}
+
+func (d *multiClustersDownloader) downloadRangeBytes(ctx context.Context, key string, offset, size int64) (int64, []byte, error) {
+	downloader, err := d.forKey(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	return downloader.downloadRangeBytes(ctx, key, offset, size)
+}
+
+func (d *multiClustersDownloader) downloadRangeReader(ctx context.Context, key string, offset, size int64) (int64, io.ReadCloser, error) {
+	downloader, err := d.forKey(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	return downloader.downloadRangeReader(ctx, key, offset, size)
+}
+
+func (d *multiClustersDownloader) open(ctx context.Context, key string) (*ObjectReader, error) {
+	downloader, err := d.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.open(ctx, key)
+}
@@ -0,0 +1,207 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ObjectReader 远程对象的只读视图，按范围下载实现随机读取，
+// 可以交给 archive/zip 等需要 io.ReaderAt 或 io.ReadSeeker 的库使用。
+// 读取时带上打开时的对象在各副本上的 ETag，对象在打开后被覆盖时读取返回 ErrPreconditionFailed
+type ObjectReader struct {
+	d       *singleClusterDownloader
+	ctx     context.Context
+	cancel  context.CancelFunc
+	key     string
+	version *objectVersion
+	size    int64
+
+	// Read 和 Seek 使用的位置，以及从该位置开始的下载
+	mu     sync.Mutex
+	offset int64
+	body   io.ReadCloser
+	closed bool
+}
+
+// 打开对象，获取对象的大小和 ETag，之后的读取都使用 ctx
+func (d *singleClusterDownloader) open(ctx context.Context, key string) (r *ObjectReader, err error) {
+	readCtx, cancel := context.WithCancel(ctx)
+	ctx, op := d.telemetry.start(ctx, OpOpen, "key", key)
+	defer func() {
+		op.end(0, err)
+	}()
+
+	v, err := d.replicas.head(ctx, op.log, key)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	op.span.SetAttributes(Attribute{Key: "size", Value: v.entry.Fsize})
+	// 之后的读取使用调用方的 ctx，不作为打开操作的子 span
+	return &ObjectReader{d: d, ctx: readCtx, cancel: cancel, key: key, version: v, size: v.entry.Fsize}, nil
+}
+
+// Size 对象的大小
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt 下载 [off, off+len(p)) 范围的数据，可以并发调用，读到对象结尾时返回 io.EOF，
+// 启用块缓存时从缓存读取
+func (r *ObjectReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if r.isClosed() {
+		return 0, os.ErrClosed
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	size := int64(len(p))
+	if size > r.size-off {
+		size = r.size - off
+	}
+	if size == 0 {
+		return 0, nil
+	}
+
+	ctx, op := r.d.telemetry.start(r.ctx, OpDownloadRange, "key", r.key, "offset", off, "size", size)
+	defer func() {
+		op.end(int64(n), err)
+	}()
+	if r.d.cache != nil {
+		obj := &cachedObject{key: r.key, etag: r.version.entry.Hash, size: r.size, version: r.version}
+		if err = r.d.cache.readAt(ctx, obj, p[:size], off, r.d.downloadBlock); err != nil {
+			return 0, err
+		}
+		n = int(size)
+	} else if err = r.d.replicas.doVersion(ctx, op.log, r.version, func(ctx context.Context, backend Backend, etag string) error {
+		output, err := backend.GetObject(ctx, r.key, &GetOptions{Range: &Range{Offset: off, Size: size}, IfMatch: etag})
+		if err != nil {
+			return err
+		}
+		defer output.Body.Close()
+		n, err = io.ReadFull(output.Body, p[:size])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	if int64(len(p)) > size {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read 从当前位置顺序读取，连续的读取复用同一个下载，读取出错后下一次 Read 从当前位置重新下载
+func (r *ObjectReader) Read(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if r.body == nil {
+		if r.body, err = r.d.rangeReader(r.ctx, r.key, r.version, r.offset, r.size-r.offset); err != nil {
+			r.body = nil
+			return 0, err
+		}
+	}
+
+	n, err = r.body.Read(p)
+	r.offset += int64(n)
+	switch {
+	case err == io.EOF && r.offset < r.size:
+		err = io.ErrUnexpectedEOF
+	case err == io.EOF:
+		err = nil
+	}
+	if err != nil || r.offset >= r.size {
+		r.closeBody()
+	}
+	if n > 0 && err != nil {
+		// 先返回已读取的数据，错误在下一次 Read 重新下载时再处理
+		return n, nil
+	}
+	return n, err
+}
+
+// Seek 设置 Read 的位置，位置变化时关闭当前的下载
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close 关闭当前的下载，之后的读取返回 os.ErrClosed，进行中的 ReadAt 被取消
+func (r *ObjectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.closeBody()
+	r.cancel()
+	return nil
+}
+
+func (r *ObjectReader) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func (r *ObjectReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+// 按范围下载对象，v 不为空时只在各副本上的对象仍为该版本时下载，Body 关闭后结束操作
+func (d *singleClusterDownloader) rangeReader(ctx context.Context, key string, v *objectVersion, offset, size int64) (body io.ReadCloser, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownloadRange, "key", key, "offset", offset, "size", size)
+	err = d.replicas.doVersionStream(ctx, op.log, v, func(ctx context.Context, cancel context.CancelFunc, backend Backend, etag string) error {
+		output, err := backend.GetObject(ctx, key, &GetOptions{Range: &Range{Offset: offset, Size: size}, IfMatch: etag})
+		if err != nil {
+			return err
+		}
+		body = &cancelOnClose{ReadCloser: output.Body, cancel: cancel}
+		return nil
+	})
+	return endOnClose(op, body, err), err
+}
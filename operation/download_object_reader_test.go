@@ -0,0 +1,128 @@
+package operation
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newObjectReaderTest(t *testing.T, data []byte) (*rangeBackend, *Downloader) {
+	backend := &rangeBackend{Backend: NewMemoryBackend()}
+	assert.NoError(t, backend.PutObject(context.Background(), "key", bytes.NewReader(data), int64(len(data)), nil))
+	downloader, err := NewDownloader(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(2)})
+	assert.NoError(t, err)
+	return backend, downloader
+}
+
+func TestObjectReader_ReadAt(t *testing.T) {
+	_, downloader := newObjectReaderTest(t, []byte("0123456789"))
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, int64(10), r.Size())
+
+	type TestCase struct {
+		off      int64
+		size     int
+		expected string
+		err      error
+	}
+	testCases := []TestCase{
+		{off: 0, size: 4, expected: "0123"},
+		{off: 6, size: 4, expected: "6789"},
+		{off: 8, size: 4, expected: "89", err: io.EOF},
+		{off: 10, size: 4, err: io.EOF},
+		{off: 3, size: 0},
+	}
+	for _, tc := range testCases {
+		p := make([]byte, tc.size)
+		n, err := r.ReadAt(p, tc.off)
+		assert.Equal(t, tc.err, err)
+		assert.Equal(t, tc.expected, string(p[:n]))
+	}
+	_, err = r.ReadAt(make([]byte, 1), -1)
+	assert.Error(t, err)
+
+	_, err = downloader.Open(context.Background(), "not-exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestObjectReader_ReadSeek(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 20)
+	backend, downloader := newObjectReaderTest(t, data)
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	defer r.Close()
+	assert.NoError(t, iotest.TestReader(r, data))
+
+	// 顺序读取只发起一次下载
+	_, err = r.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	backend.gets = 0
+	downloaded, err := io.ReadAll(iotest.OneByteReader(r))
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, 1, backend.gets)
+
+	pos, err := r.Seek(-4, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)-4), pos)
+	downloaded, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(downloaded))
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
+
+func TestObjectReader_Zip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		f, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte("content of " + name))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	_, downloader := newObjectReaderTest(t, buf.Bytes())
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	defer r.Close()
+
+	zr, err := zip.NewReader(r, r.Size())
+	assert.NoError(t, err)
+	assert.Len(t, zr.File, 2)
+	f, err := zr.Open("b.txt")
+	assert.NoError(t, err)
+	content, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "content of b.txt", string(content))
+}
+
+func TestObjectReader_Changed(t *testing.T) {
+	backend, downloader := newObjectReaderTest(t, []byte("0123456789"))
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+
+	// 打开后对象被覆盖
+	assert.NoError(t, backend.PutObject(context.Background(), "key", bytes.NewReader([]byte("abcdefghij")), 10, nil))
+	_, err = r.ReadAt(make([]byte, 4), 0)
+	assert.True(t, errors.Is(err, ErrPreconditionFailed))
+	_, err = r.Read(make([]byte, 4))
+	assert.True(t, errors.Is(err, ErrPreconditionFailed))
+
+	assert.NoError(t, r.Close())
+	_, err = r.ReadAt(make([]byte, 4), 0)
+	assert.Equal(t, os.ErrClosed, err)
+	_, err = r.Read(make([]byte, 4))
+	assert.Equal(t, os.ErrClosed, err)
+	assert.NoError(t, r.Close())
+}
@@ -0,0 +1,201 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 副本出错后默认被跳过的时长
+const defaultFailoverCooldown = 30 * time.Second
+
+// 下载使用的副本集合，第一个为主副本
+// 出错的副本在冷却时间内排到健康副本之后，所有副本都不健康时仍按原顺序尝试
+type replicaSet struct {
+	backends []Backend
+	cooldown time.Duration
+	retry    *RetryPolicy
+
+	mu        sync.Mutex
+	unhealthy map[int]time.Time
+}
+
+func newReplicaSet(c *Config) (*replicaSet, error) {
+	cooldown := c.FailoverCooldown
+	if cooldown <= 0 {
+		cooldown = defaultFailoverCooldown
+	}
+	set := &replicaSet{cooldown: cooldown, retry: newRetryPolicy(c.RetryPolicy), unhealthy: make(map[int]time.Time)}
+
+	for _, config := range append([]*Config{c}, c.Replicas...) {
+		backend, err := newBackend(config)
+		if err != nil {
+			return nil, err
+		}
+		set.backends = append(set.backends, backend)
+	}
+	return set, nil
+}
+
+// 返回本次尝试的副本顺序，健康的副本在前
+func (s *replicaSet) order() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var healthy, unhealthy []int
+	now := time.Now()
+	for i := range s.backends {
+		if until, ok := s.unhealthy[i]; ok && now.Before(until) {
+			unhealthy = append(unhealthy, i)
+		} else {
+			delete(s.unhealthy, i)
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (s *replicaSet) markUnhealthy(i int) {
+	s.mu.Lock()
+	s.unhealthy[i] = time.Now().Add(s.cooldown)
+	s.mu.Unlock()
+}
+
+// 按副本顺序执行 fn，次数由重试策略决定且每个副本至少尝试一次，
+// 遇到可重试的错误时标记当前副本不健康并切换到下一个副本，其他错误或 ctx 结束时直接返回
+func (s *replicaSet) do(ctx context.Context, log *fieldLogger, fn func(ctx context.Context, backend Backend) error) error {
+	return s.doStream(ctx, log, func(ctx context.Context, cancel context.CancelFunc, backend Backend) error {
+		defer cancel()
+		return fn(ctx, backend)
+	})
+}
+
+// 与 do 相同，但成功时由 fn 负责调用 cancel，用于返回 Body 的请求
+func (s *replicaSet) doStream(ctx context.Context, log *fieldLogger, fn func(ctx context.Context, cancel context.CancelFunc, backend Backend) error) error {
+	return s.doReplica(ctx, log, func(ctx context.Context, cancel context.CancelFunc, replica int, backend Backend) error {
+		return fn(ctx, cancel, backend)
+	})
+}
+
+// 与 doStream 相同，fn 同时收到副本的序号
+func (s *replicaSet) doReplica(ctx context.Context, log *fieldLogger, fn func(ctx context.Context, cancel context.CancelFunc, replica int, backend Backend) error) error {
+	if len(s.backends) == 0 {
+		return ErrClientNotInitialized
+	}
+
+	order := s.order()
+	attempts := s.retry.MaxAttempts
+	if attempts < len(order) {
+		attempts = len(order)
+	}
+	var (
+		err  error
+		span = spanFromContext(ctx)
+	)
+	for i := 0; i < attempts; i++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		span.SetAttributes(Attribute{Key: "attempts", Value: i + 1})
+		if i >= len(order) {
+			// 所有副本都已尝试过，等待后再重试
+			if sleepErr := s.retry.sleep(ctx, s.retry.backoff(i-len(order)+1)); sleepErr != nil {
+				return retryInterrupted(sleepErr, err)
+			}
+		}
+		index := order[i%len(order)]
+		span.SetAttributes(Attribute{Key: "replica", Value: index})
+		attemptCtx, cancel := s.retry.attemptContext(ctx)
+		if err = fn(attemptCtx, cancel, index, s.backends[index]); err == nil {
+			return nil
+		}
+		cancel()
+		if !s.retry.shouldRetry(ctx, err) {
+			// 不可重试的错误，或请求被取消、超时，不是副本的问题
+			return err
+		}
+		log.warn("attempt failed", "attempt", i+1, "replica", index, "error", err)
+		if i+1 < attempts {
+			progressFromContext(ctx).retry(i+1, err)
+		}
+		s.markUnhealthy(index)
+	}
+	return err
+}
+
+// 获取对象的元信息，记录返回元信息的副本
+func (s *replicaSet) head(ctx context.Context, log *fieldLogger, key string) (*objectVersion, error) {
+	var v *objectVersion
+	err := s.doReplica(ctx, log, func(ctx context.Context, cancel context.CancelFunc, replica int, backend Backend) error {
+		defer cancel()
+		entry, err := backend.HeadObject(ctx, key)
+		if err != nil {
+			return err
+		}
+		v = newObjectVersion(key, replica, entry)
+		return nil
+	})
+	return v, err
+}
+
+// 与 do 相同，etag 为 v 在当前副本上的 ETag，用于 If-Match。v 为 nil 时 etag 为空
+func (s *replicaSet) doVersion(ctx context.Context, log *fieldLogger, v *objectVersion, fn func(ctx context.Context, backend Backend, etag string) error) error {
+	return s.doVersionStream(ctx, log, v, func(ctx context.Context, cancel context.CancelFunc, backend Backend, etag string) error {
+		defer cancel()
+		return fn(ctx, backend, etag)
+	})
+}
+
+// 与 doStream 相同，etag 为 v 在当前副本上的 ETag
+func (s *replicaSet) doVersionStream(ctx context.Context, log *fieldLogger, v *objectVersion, fn func(ctx context.Context, cancel context.CancelFunc, backend Backend, etag string) error) error {
+	return s.doReplica(ctx, log, func(ctx context.Context, cancel context.CancelFunc, replica int, backend Backend) error {
+		etag, err := v.etagOn(ctx, replica, backend)
+		if err != nil {
+			cancel()
+			return err
+		}
+		return fn(ctx, cancel, backend, etag)
+	})
+}
+
+// 对象在各个副本上的同一版本。副本分别写入时同样的内容 ETag 也可能不同（如分片上传），
+// 一个副本的 ETag 不能作为 If-Match 发给其他副本：切换到其他副本时先获取该副本的元信息，
+// ETag 相同，或者大小相同且校验值（元数据中的校验值或单段上传的 ETag）相等才视为同一版本，
+// 之后的请求使用该副本自己的 ETag。无法确认时视为不同版本，不拼接两个副本的数据
+type objectVersion struct {
+	key   string
+	entry *Entry
+
+	mu    sync.Mutex
+	etags map[int]string
+}
+
+func newObjectVersion(key string, replica int, entry *Entry) *objectVersion {
+	return &objectVersion{key: key, entry: entry, etags: map[int]string{replica: entry.Hash}}
+}
+
+// 副本上该版本的 ETag，副本上的对象不是同一版本时返回 ErrPreconditionFailed
+func (v *objectVersion) etagOn(ctx context.Context, replica int, backend Backend) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	v.mu.Lock()
+	etag, ok := v.etags[replica]
+	v.mu.Unlock()
+	if ok {
+		return etag, nil
+	}
+
+	entry, err := backend.HeadObject(ctx, v.key)
+	if err != nil {
+		return "", err
+	}
+	if entry.Hash != v.entry.Hash && !sameContent(v.entry, entry) {
+		return "", fmt.Errorf("object %s on replica %d differs from the version being read: %w", v.key, replica, ErrPreconditionFailed)
+	}
+	v.mu.Lock()
+	v.etags[replica] = entry.Hash
+	v.mu.Unlock()
+	return entry.Hash, nil
+}
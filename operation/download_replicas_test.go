@@ -0,0 +1,200 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 下载时返回指定错误的存储后端
+type failingBackend struct {
+	Backend
+	err   error
+	calls int
+}
+
+func (b *failingBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	b.calls++
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.Backend.GetObject(ctx, key, opts)
+}
+
+func TestDownloader_Failover(t *testing.T) {
+	primary := &failingBackend{Backend: NewMemoryBackend(), err: newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")}
+	secondary := &failingBackend{Backend: NewMemoryBackend()}
+	err := secondary.PutObject(context.Background(), "key", strings.NewReader("data"), 4, nil)
+	assert.NoError(t, err)
+
+	downloader, err := NewDownloader(&Config{
+		Backend:          primary,
+		Replicas:         []*Config{{Backend: secondary}},
+		FailoverCooldown: time.Hour,
+	})
+	assert.NoError(t, err)
+
+	data, err := downloader.DownloadBytes("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	assert.Equal(t, 1, primary.calls)
+
+	// 冷却时间内跳过主副本
+	_, data, err = downloader.DownloadRangeBytes("key", 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "at", string(data))
+	assert.Equal(t, 1, primary.calls)
+
+	// 网络错误同样切换副本
+	secondary.err = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	primary.err = nil
+	err = primary.PutObject(context.Background(), "key", strings.NewReader("primary"), 7, nil)
+	assert.NoError(t, err)
+	data, err = downloader.DownloadBytes("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", string(data))
+
+	// 4xx 不切换副本
+	secondary.err = nil
+	secondary.calls = 0
+	_, err = downloader.DownloadBytes("not-exist")
+	assert.Equal(t, http.StatusNotFound, statusCodeOf(err))
+	assert.Equal(t, 0, secondary.calls)
+}
+
+func TestReplicaSet_Cooldown(t *testing.T) {
+	set := &replicaSet{
+		backends:  []Backend{NewMemoryBackend(), NewMemoryBackend(), NewMemoryBackend()},
+		cooldown:  time.Hour,
+		unhealthy: make(map[int]time.Time),
+	}
+	assert.Equal(t, []int{0, 1, 2}, set.order())
+
+	set.markUnhealthy(0)
+	assert.Equal(t, []int{1, 2, 0}, set.order())
+
+	set.unhealthy[0] = time.Now().Add(-time.Second)
+	assert.Equal(t, []int{0, 1, 2}, set.order())
+}
+
+func TestReplicaSet_Interrupted(t *testing.T) {
+	set := &replicaSet{
+		backends:  []Backend{NewMemoryBackend(), NewMemoryBackend()},
+		cooldown:  time.Hour,
+		retry:     newRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute}),
+		unhealthy: make(map[int]time.Time),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// 所有副本都失败后等待重试时 ctx 结束，返回 ctx 的错误
+	calls := 0
+	err := set.do(ctx, newFieldLogger(&Config{}), func(ctx context.Context, backend Backend) error {
+		calls++
+		return newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")
+	})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDownloader_FailoverDifferentETags(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	data := bytes.Repeat([]byte("0123456789"), partSize/5+1)
+	// 副本分别写入，同样的内容 ETag 不同：主副本为带校验值元数据的分片上传，副本为单段上传
+	sum := md5.Sum(data)
+	memory := NewMemoryBackend()
+	memory.putObject("key", data, "primary-etag-2", checksumMetadata(ChecksumMD5, hex.EncodeToString(sum[:])))
+	primary := &failingBackend{Backend: memory}
+	secondary := &failingBackend{Backend: NewMemoryBackend()}
+	assert.NoError(t, secondary.PutObject(context.Background(), "key", bytes.NewReader(data), int64(len(data)), nil))
+
+	newDownloader := func(cache *BlockCacheConfig) *Downloader {
+		downloader, err := NewDownloader(&Config{
+			Backend:  primary,
+			Replicas: []*Config{{Backend: secondary}},
+			PartSize: 4,
+			// failingBackend 不支持并发调用
+			DownConcurrency:  1,
+			FailoverCooldown: time.Nanosecond,
+			BlockCache:       cache,
+		})
+		assert.NoError(t, err)
+		return downloader
+	}
+
+	// 从主副本获取元信息后下载失败，切换副本时使用副本自己的 ETag
+	primary.err = newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")
+	downloader := newDownloader(nil)
+	f, err := downloader.DownloadFile("key", filepath.Join(t.TempDir(), "file"))
+	assert.NoError(t, err)
+	downloaded, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, data, downloaded)
+
+	r, err := downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	p := make([]byte, 10)
+	_, err = r.ReadAt(p, partSize)
+	assert.NoError(t, err)
+	assert.Equal(t, data[partSize:partSize+10], p)
+	_, err = r.Read(p)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:10], p)
+	r.Close()
+
+	_, downloaded, err = newDownloader(&BlockCacheConfig{BlockSize: 16, ReadAhead: -1}).DownloadRangeBytes("key", 20, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, data[20:30], downloaded)
+
+	// 副本上的对象不是同一版本时不读取
+	assert.NoError(t, secondary.PutObject(context.Background(), "key", strings.NewReader("changed"), 7, nil))
+	r, err = downloader.Open(context.Background(), "key")
+	assert.NoError(t, err)
+	_, err = r.ReadAt(p, 0)
+	assert.True(t, errors.Is(err, ErrPreconditionFailed))
+	r.Close()
+
+	// 大小相同但没有可比较的校验值时无法确认是同一版本，同样不读取
+	memory.putObject("multipart", []byte("aaaa"), "etag-a-2", nil)
+	secondary.Backend.(*MemoryBackend).putObject("multipart", []byte("bbbb"), "etag-b-2", nil)
+	r, err = downloader.Open(context.Background(), "multipart")
+	assert.NoError(t, err)
+	defer r.Close()
+	_, err = r.ReadAt(p[:4], 0)
+	assert.True(t, errors.Is(err, ErrPreconditionFailed))
+}
+
+func TestSameContent(t *testing.T) {
+	md5Metadata := checksumMetadata(ChecksumMD5, "0123456789abcdef0123456789abcdef")
+	type TestCase struct {
+		a, b     *Entry
+		expected bool
+	}
+	testCases := []TestCase{
+		// 单段上传的 ETag 即 MD5
+		{a: &Entry{Hash: `"0123456789abcdef0123456789abcdef"`, Fsize: 4}, b: &Entry{Hash: "0123456789ABCDEF0123456789ABCDEF", Fsize: 4}, expected: true},
+		{a: &Entry{Hash: "0123456789abcdef0123456789abcdef", Fsize: 4}, b: &Entry{Hash: "fedcba98765432100123456789abcdef", Fsize: 4}, expected: false},
+		// 元数据中的 MD5 与单段上传的 ETag 比较
+		{a: &Entry{Hash: "etag-2", Fsize: 4, Metadata: md5Metadata}, b: &Entry{Hash: "0123456789abcdef0123456789abcdef", Fsize: 4}, expected: true},
+		{a: &Entry{Hash: "etag-2", Fsize: 4, Metadata: checksumMetadata(ChecksumSHA256, "aa")}, b: &Entry{Hash: "etag-3", Fsize: 4, Metadata: checksumMetadata(ChecksumSHA256, "AA")}, expected: true},
+		{a: &Entry{Hash: "etag-2", Fsize: 4, Metadata: md5Metadata}, b: &Entry{Hash: "0123456789abcdef0123456789abcdef", Fsize: 5}, expected: false},
+		// 没有可比较的校验值
+		{a: &Entry{Hash: "etag-2", Fsize: 4}, b: &Entry{Hash: "0123456789abcdef0123456789abcdef", Fsize: 4}, expected: false},
+		{a: &Entry{Hash: "etag-2", Fsize: 4, Metadata: checksumMetadata(ChecksumSHA256, "aa")}, b: &Entry{Hash: "etag-3", Fsize: 4, Metadata: checksumMetadata(ChecksumCRC64, "aa")}, expected: false},
+	}
+	for i, tc := range testCases {
+		assert.Equal(t, tc.expected, sameContent(tc.a, tc.b), "case %d", i)
+	}
+}
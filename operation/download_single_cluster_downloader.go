@@ -1,54 +1,59 @@
 package operation
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"os"
-
-	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
 )
 
 type singleClusterDownloader struct {
-	bucket        string
-	partSize      int64
-	upConcurrency int
-	client        *obs.ObsClient
+	bucket          string
+	partSize        int64
+	downConcurrency int
+	verify          bool
+	cache           *blockCache
+	replicas        *replicaSet
+	telemetry       *telemetry
 }
 
-func newSingleClusterDownloader(c *Config) *singleClusterDownloader {
-	lister := singleClusterDownloader{}
-	obsClient, err := obs.New(c.Ak, c.Sk, c.EndPoint)
-
+func newSingleClusterDownloader(c *Config) (*singleClusterDownloader, error) {
+	replicas, err := newReplicaSet(c)
 	if err != nil {
-		fmt.Printf("Create obsClient error, errMsg: %s", err.Error())
+		return nil, err
+	}
+	if err = checkChecksumAlgorithm(c.Checksum); err != nil {
+		return nil, err
 	}
 
-	lister.client = obsClient
+	lister := singleClusterDownloader{}
+	lister.replicas = replicas
 	lister.bucket = c.Bucket
+	lister.telemetry = newTelemetry(c)
+	lister.verify = c.Checksum != ""
 
-	if c.UpConcurrency <= 0 {
-		lister.upConcurrency = 20
+	lister.downConcurrency = c.DownConcurrency
+	if lister.downConcurrency <= 0 {
+		lister.downConcurrency = 20
 	}
 	part := c.PartSize * 1024 * 1024
 	if part < 4*1024*1024 {
 		part = 4 * 1024 * 1024
 	}
 	lister.partSize = part
-	return &lister
-}
 
-func (d *singleClusterDownloader) downloadRawInner(key string, headers http.Header) (resp io.ReadCloser, err error) {
-
-	if d.client == nil {
-		return nil, errors.New("obsclient is nil")
+	if c.BlockCache != nil {
+		if lister.cache, err = newBlockCache(c.BlockCache, c.Bucket, lister.downConcurrency); err != nil {
+			return nil, err
+		}
 	}
+	return &lister, nil
+}
 
-	input := &obs.GetObjectInput{}
-	input.Bucket = d.bucket
-	input.Key = key
-	output, err := d.client.GetObject(input)
+func (d *singleClusterDownloader) downloadRawInner(ctx context.Context, backend Backend, key string, headers http.Header) (resp io.ReadCloser, err error) {
+	output, err := backend.GetObject(ctx, key, nil)
 
 	if err == nil {
 		return output.Body, nil
@@ -56,146 +61,131 @@ func (d *singleClusterDownloader) downloadRawInner(key string, headers http.Head
 	return nil, err
 }
 
-func (d *singleClusterDownloader) downloadRaw(key string, headers http.Header) (resp io.ReadCloser, err error) {
-	for i := 0; i < 3; i++ {
-		resp, err = d.downloadRawInner(key, headers)
-		if err == nil {
-			return
+func (d *singleClusterDownloader) downloadRaw(ctx context.Context, key string, headers http.Header) (resp io.ReadCloser, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownload, "key", key)
+	err = d.replicas.doStream(ctx, op.log, func(ctx context.Context, cancel context.CancelFunc, backend Backend) (err error) {
+		if resp, err = d.downloadRawInner(ctx, backend, key, headers); err == nil {
+			resp = &cancelOnClose{ReadCloser: resp, cancel: cancel}
 		}
-	}
-	return
+		return
+	})
+	return endOnClose(op, resp, err), err
 }
 
-func (d *singleClusterDownloader) downloadRangeReader(key string, offset, size int64) (l int64, reader io.ReadCloser, err error) {
-	for i := 0; i < 3; i++ {
-		l, reader, err = d.downloadRangeReaderInner(key, offset, size)
-		if err == nil {
-			break
+func (d *singleClusterDownloader) downloadRangeReader(ctx context.Context, key string, offset, size int64) (l int64, reader io.ReadCloser, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownloadRange, "key", key, "offset", offset, "size", size)
+	err = d.replicas.doStream(ctx, op.log, func(ctx context.Context, cancel context.CancelFunc, backend Backend) (err error) {
+		if l, reader, err = d.downloadRangeReaderInner(ctx, backend, key, offset, size); err == nil {
+			reader = &cancelOnClose{ReadCloser: reader, cancel: cancel}
 		}
-	}
-	return
+		return
+	})
+	return l, endOnClose(op, reader, err), err
 }
 
-func (d *singleClusterDownloader) downloadRangeReaderInner(key string, offset, size int64) (int64, io.ReadCloser, error) {
-	if d.client == nil {
-		return -1, nil, errors.New("obsclient is nil")
+// 请求失败时直接结束操作，成功时在 Body 关闭后结束
+func endOnClose(op *operationRun, body io.ReadCloser, err error) io.ReadCloser {
+	if err != nil {
+		op.end(0, err)
+		return body
 	}
+	return &observedBody{ReadCloser: body, observe: op.end}
+}
 
-	input := &obs.GetObjectInput{}
-	input.Bucket = d.bucket
-	input.Key = key
-	output, err := d.client.GetObject(input, obs.WithCustomHeader("Range", generateRange(offset, size)))
+func (d *singleClusterDownloader) downloadRangeReaderInner(ctx context.Context, backend Backend, key string, offset, size int64) (int64, io.ReadCloser, error) {
+	output, err := backend.GetObject(ctx, key, &GetOptions{Range: &Range{Offset: offset, Size: size}})
 
 	if err != nil {
 		return -1, nil, err
 	}
 
-	if output.StatusCode != http.StatusPartialContent {
-		output.Body.Close()
-		return -1, nil, err
-	}
-
-	return output.ContentLength, output.Body, err
+	return output.ContentLength, output.Body, nil
 }
 
-// DownloadRangeBytes 下载指定对象的指定范围到内存中
-func (d *singleClusterDownloader) downloadRangeBytes(key string, offset, size int64) (l int64, data []byte, err error) {
-	l, r, err := d.downloadRangeReaderInner(key, offset, size)
-	if err != nil {
-		return l, nil, err
-	}
-	b, err := io.ReadAll(r)
-	r.Close()
-	return l, b, err
-}
+// DownloadRangeBytes 下载指定对象的指定范围到内存中，启用块缓存时从缓存读取
+func (d *singleClusterDownloader) downloadRangeBytes(ctx context.Context, key string, offset, size int64) (l int64, data []byte, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownloadRange, "key", key, "offset", offset, "size", size)
+	defer func() {
+		op.end(int64(len(data)), err)
+	}()
 
-func (d *singleClusterDownloader) downloadBytes(key string) (data []byte, err error) {
-	for i := 0; i < 3; i++ {
-		data, err = d.downloadBytesInner(key)
-		if err == nil {
-			break
+	if d.cache != nil {
+		l, data, err = d.cachedRangeBytes(ctx, op.log, key, offset, size)
+		return
+	}
+	err = d.replicas.do(ctx, op.log, func(ctx context.Context, backend Backend) error {
+		var r io.ReadCloser
+		l, r, err = d.downloadRangeReaderInner(ctx, backend, key, offset, size)
+		if err != nil {
+			return err
 		}
+		defer r.Close()
+		data, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		data = nil
 	}
 	return
 }
 
-func (d *singleClusterDownloader) downloadBytesInner(key string) ([]byte, error) {
-
-	if d.client == nil {
-		return nil, errors.New("obsclient is nil")
-	}
+func (d *singleClusterDownloader) downloadBytes(ctx context.Context, key string) (data []byte, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownload, "key", key)
+	defer func() {
+		op.end(int64(len(data)), err)
+	}()
 
-	input := &obs.GetObjectInput{}
-	input.Bucket = d.bucket
-	input.Key = key
+	err = d.replicas.do(ctx, op.log, func(ctx context.Context, backend Backend) (err error) {
+		data, err = d.downloadBytesInner(ctx, backend, key)
+		return
+	})
+	return
+}
 
-	output, err := d.client.GetObject(input)
+// 开启校验时按对象的元数据或 ETag 校验下载的数据
+func (d *singleClusterDownloader) downloadBytesInner(ctx context.Context, backend Backend, key string) ([]byte, error) {
+	output, err := backend.GetObject(ctx, key, nil)
 
 	if err != nil {
 		return nil, err
 	}
 	defer output.Body.Close()
 
-	if output.StatusCode != http.StatusOK {
-		return nil, errors.New("output.Status")
+	data, err := io.ReadAll(output.Body)
+	if err != nil || !d.verify {
+		return data, err
 	}
-	return io.ReadAll(output.Body)
-}
-
-func (d *singleClusterDownloader) downloadFile(key, path string) (f *os.File, err error) {
-	failedIoHosts := make(map[string]struct{})
-	for i := 0; i < 3; i++ {
-		f, err = d.downloadFileInner(key, path, failedIoHosts)
-		if err == nil {
-			return
-		}
+	if err = verifyChecksum(&output.Entry, bytes.NewReader(data)); err != nil {
+		return nil, err
 	}
-	return
+	return data, nil
 }
-func (d *singleClusterDownloader) downloadFileInner(key, path string, failedIoHosts map[string]struct{}) (*os.File, error) {
-	var length int64 = 0
-	var f *os.File
-	var err error
-	f, err = os.OpenFile(path, os.O_RDWR, 0644)
-	if err == nil {
-		length, err = f.Seek(0, io.SeekEnd)
+
+// 按 PartSize 分段并发下载到文件，记录已完成的分段，再次下载同一对象到同一文件时续传。
+// 对象在下载过程中变化时重新开始下载一次
+func (d *singleClusterDownloader) downloadFile(ctx context.Context, key, path string) (f *os.File, err error) {
+	ctx, op := d.telemetry.start(ctx, OpDownloadFile, "key", key, "file", path)
+	ctx, progress := startProgress(ctx, OpDownloadFile, d.bucket, key, -1)
+	var size int64
+	defer func() {
 		if err != nil {
-			return nil, err
+			size = 0
 		}
-	} else if !os.IsNotExist(err) {
-		return nil, err
-	}
+		op.end(size, err)
+		progress.finish(err)
+	}()
 
-	input := &obs.GetObjectInput{}
-	input.Bucket = d.bucket
-	input.Key = key
-	output, err := d.client.GetObject(input, obs.WithCustomHeader("Range", fmt.Sprintf("bytes=%d-", length)))
-
-	if err != nil {
-		return nil, err
-	}
-	defer output.Body.Close()
-
-	if output.StatusCode != http.StatusOK && output.StatusCode != http.StatusPartialContent {
-		return nil, err
-	}
-	ctLength := output.ContentLength
-	if f == nil {
-		f, err = os.OpenFile(path, os.O_CREATE, 0644)
-		if err != nil {
+	for restarted := false; ; restarted = true {
+		var v *objectVersion
+		if v, err = d.replicas.head(ctx, op.log, key); err != nil {
 			return nil, err
 		}
+		size = v.entry.Fsize
+		op.span.SetAttributes(Attribute{Key: "size", Value: size})
+		f, err = d.downloadRanges(ctx, op.log, key, path, v)
+		if err == nil || restarted || !errors.Is(err, ErrPreconditionFailed) {
+			return f, err
+		}
+		op.log.warn("object changed during download, restart", "error", err)
 	}
-
-	n, err := io.Copy(f, output.Body)
-	if err != nil {
-		return nil, err
-	}
-	if ctLength != n {
-		fmt.Println("download length not equal", ctLength, n)
-	}
-	if _, err = f.Seek(0, io.SeekStart); err != nil {
-		return nil, err
-	}
-	return f, nil
 }
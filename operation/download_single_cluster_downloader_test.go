@@ -2,7 +2,16 @@ package operation
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -10,14 +19,16 @@ import (
 func TestDownloader_DownloadBytes(t *testing.T) {
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	data := []byte("test1")
-	err := uploader.UploadData(data, "test1")
+	err = uploader.UploadData(data, "test1")
 	assert.NoError(t, err)
 
 	// downloader
-	downloader := NewDownloader(config)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
 	_data, err := downloader.DownloadBytes("test1")
 	assert.NoError(t, err)
 	assert.Equal(t, data, _data)
@@ -26,14 +37,16 @@ func TestDownloader_DownloadBytes(t *testing.T) {
 func TestDownloader_DownloadRaw(t *testing.T) {
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	data := []byte("test1")
-	err := uploader.UploadData(data, "test1")
+	err = uploader.UploadData(data, "test1")
 	assert.NoError(t, err)
 
 	// downloader
-	downloader := NewDownloader(config)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
 	body, err := downloader.DownloadRaw("test1", nil)
 	assert.NoError(t, err)
 
@@ -48,33 +61,213 @@ func TestDownloader_DownloadRaw(t *testing.T) {
 func TestDownloader_DownloadRangeReader(t *testing.T) {
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	data := []byte("test1")
-	err := uploader.UploadData(data, "test1")
+	err = uploader.UploadData(data, "test1")
 	assert.NoError(t, err)
 
 	// downloader
-	downloader := NewDownloader(config)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
 	l, _, err := downloader.DownloadRangeReader("test1", 0, 1)
 	assert.NoError(t, err)
-	assert.Equal(t, l, 1)
+	assert.Equal(t, int64(1), l)
 	// assert.Equal(t, data, body)
 }
 
 func TestDownloader_DownloadFile(t *testing.T) {
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	data := []byte("test1")
-	err := uploader.UploadData(data, "test1")
+	err = uploader.UploadData(data, "test1")
 	assert.NoError(t, err)
 
 	// downloader
-	downloader := NewDownloader(config)
-	file, err := downloader.DownloadFile("test1", "test.txt")
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	file, err := downloader.DownloadFile("test1", filepath.Join(t.TempDir(), "test.txt"))
 	assert.NoError(t, err)
 	defer file.Close()
 	// assert.Equal(t, data, body)
 }
+
+// 记录分段下载的存储后端，failOffset 处的分段返回 failErr，
+// onGet 在每次下载前调用，shortRead 时返回的数据少一个字节
+type rangeBackend struct {
+	Backend
+	failOffset int64
+	failErr    error
+	onGet      func(opts *GetOptions)
+	shortRead  bool
+
+	mu        sync.Mutex
+	gets      int
+	inflight  int
+	maxFlight int
+}
+
+func (b *rangeBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	b.mu.Lock()
+	b.gets++
+	b.inflight++
+	if b.inflight > b.maxFlight {
+		b.maxFlight = b.inflight
+	}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.inflight--
+		b.mu.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond)
+	if b.onGet != nil {
+		b.onGet(opts)
+	}
+	if b.failErr != nil && opts != nil && opts.Range != nil && opts.Range.Offset == b.failOffset {
+		return nil, b.failErr
+	}
+	output, err := b.Backend.GetObject(ctx, key, opts)
+	if err == nil && b.shortRead {
+		output.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(output.Body, output.ContentLength-1), output.Body}
+	}
+	return output, err
+}
+
+func newRangeTestObject(t *testing.T, backend Backend, size int) []byte {
+	data := make([]byte, size)
+	rand.Read(data)
+	assert.NoError(t, backend.PutObject(context.Background(), "key", bytes.NewReader(data), int64(size), nil))
+	return data
+}
+
+func TestDownloader_DownloadFileRanges(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	backend := &rangeBackend{Backend: NewMemoryBackend()}
+	data := newRangeTestObject(t, backend, 3*partSize+10)
+	downloader, err := NewDownloader(&Config{Backend: backend, PartSize: 4, DownConcurrency: 3})
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "file")
+	f, err := downloader.DownloadFile("key", path)
+	assert.NoError(t, err)
+	downloaded, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, 4, backend.gets)
+	assert.Equal(t, 3, backend.maxFlight)
+	_, err = os.Stat(downloadCheckpointPath(path))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloader_DownloadFileResume(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	backend := &rangeBackend{Backend: NewMemoryBackend(), failOffset: partSize, failErr: newObsError(http.StatusForbidden, "AccessDenied", "")}
+	data := newRangeTestObject(t, backend, 3*partSize+10)
+	downloader, err := NewDownloader(&Config{Backend: backend, PartSize: 4, DownConcurrency: 1})
+	assert.NoError(t, err)
+
+	// 第 2 个分段失败，保留已完成的分段和断点，目标文件不变
+	path := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+	_, err = downloader.DownloadFile("key", path)
+	assert.Equal(t, http.StatusForbidden, statusCodeOf(err))
+	raw, err := os.ReadFile(downloadCheckpointPath(path))
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"parts":[1]`)
+	old, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(old))
+
+	// 续传时只下载未完成的分段
+	backend.failErr = nil
+	backend.gets = 0
+	f, err := downloader.DownloadFile("key", path)
+	assert.NoError(t, err)
+	downloaded, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, 3, backend.gets)
+	_, err = os.Stat(downloadCheckpointPath(path))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(downloadTempPath(path))
+	assert.True(t, os.IsNotExist(err))
+
+	// 对象变化后断点失效，重新下载
+	backend.failErr = newObsError(http.StatusForbidden, "AccessDenied", "")
+	_, err = downloader.DownloadFile("key", path)
+	assert.Error(t, err)
+	data = newRangeTestObject(t, backend, 2*partSize)
+	backend.failErr = nil
+	backend.gets = 0
+	f, err = downloader.DownloadFile("key", path)
+	assert.NoError(t, err)
+	downloaded, err = io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, 2, backend.gets)
+}
+
+func TestDownloader_DownloadFileObjectChanged(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	backend := &rangeBackend{Backend: NewMemoryBackend()}
+	newRangeTestObject(t, backend, 2*partSize+10)
+	downloader, err := NewDownloader(&Config{Backend: backend, PartSize: 4, DownConcurrency: 1})
+	assert.NoError(t, err)
+
+	// 下载第 2 个分段前对象被覆盖，大小不变
+	var data []byte
+	backend.onGet = func(opts *GetOptions) {
+		if data == nil && opts.Range.Offset == partSize {
+			data = newRangeTestObject(t, backend.Backend, 2*partSize+10)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	f, err := downloader.DownloadFile("key", path)
+	assert.NoError(t, err)
+	downloaded, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, data, downloaded)
+
+	// 断点记录的对象版本与当前对象不同时重新下载
+	backend.onGet = nil
+	backend.failOffset, backend.failErr = partSize, newObsError(http.StatusForbidden, "AccessDenied", "")
+	_, err = downloader.DownloadFile("key", path)
+	assert.Error(t, err)
+	data = newRangeTestObject(t, backend, 2*partSize+10)
+	backend.failErr = nil
+	backend.gets = 0
+	f, err = downloader.DownloadFile("key", path)
+	assert.NoError(t, err)
+	downloaded, err = io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, data, downloaded)
+	assert.Equal(t, 3, backend.gets)
+}
+
+func TestDownloader_DownloadFileShortRead(t *testing.T) {
+	backend := &rangeBackend{Backend: NewMemoryBackend(), shortRead: true}
+	newRangeTestObject(t, backend, 10)
+	downloader, err := NewDownloader(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(2)})
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "file")
+	_, err = downloader.DownloadFile("key", path)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	assert.Equal(t, 2, backend.gets)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
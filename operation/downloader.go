@@ -1,17 +1,19 @@
 package operation
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"os"
 )
 
 type clusterDownloader interface {
-	downloadRaw(key string, headers http.Header) (io.ReadCloser, error)
-	downloadFile(key, path string) (f *os.File, err error)
-	downloadBytes(key string) (data []byte, err error)
-	downloadRangeBytes(key string, offset, size int64) (l int64, data []byte, err error)
-	downloadRangeReader(key string, offset, size int64) (l int64, reader io.ReadCloser, err error)
+	downloadRaw(ctx context.Context, key string, headers http.Header) (io.ReadCloser, error)
+	downloadFile(ctx context.Context, key, path string) (f *os.File, err error)
+	downloadBytes(ctx context.Context, key string) (data []byte, err error)
+	downloadRangeBytes(ctx context.Context, key string, offset, size int64) (l int64, data []byte, err error)
+	downloadRangeReader(ctx context.Context, key string, offset, size int64) (l int64, reader io.ReadCloser, err error)
+	open(ctx context.Context, key string) (*ObjectReader, error)
 }
 
 // Downloader 下载器
@@ -20,39 +22,92 @@ type Downloader struct {
 }
 
 // NewDownloader 根据配置创建下载器
-func NewDownloader(c *Config) *Downloader {
-	newSingleClusterDownloader(c)
-	return &Downloader{}
+func NewDownloader(c *Config) (*Downloader, error) {
+	downloader, err := newSingleClusterDownloader(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Downloader{downloader}, nil
+}
+
+// NewMultiClustersDownloader 根据多集群配置创建下载器，按路由规则将 key 分配到各个集群
+func NewMultiClustersDownloader(c *MultiClustersConfig) (*Downloader, error) {
+	downloader, err := newMultiClustersDownloader(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Downloader{downloader}, nil
 }
 
 // DownloadCheck 检查文件
 func (d *Downloader) DownloadCheck(key string) (l int64, err error) {
-	l, _, err = d.DownloadRangeBytes(key, -1, 4)
+	return d.DownloadCheckContext(context.Background(), key)
+}
+
+// DownloadCheckContext 检查文件，ctx 取消时中止请求
+func (d *Downloader) DownloadCheckContext(ctx context.Context, key string) (l int64, err error) {
+	l, _, err = d.DownloadRangeBytesContext(ctx, key, -1, 4)
 	return
 }
 
 // 与七牛SDK不同，这里不支持headers,也不支持返回http.Response, 支持返回io.Reader
 // DownloadRaw 使用给定的 HTTP Header 请求下载接口，并直接获得 http.Response 响应
 func (d *Downloader) DownloadRaw(key string, headers http.Header) (io.ReadCloser, error) {
-	return d.downloadRaw(key, headers)
+	return d.DownloadRawContext(context.Background(), key, headers)
+}
+
+// DownloadRawContext 使用给定的 HTTP Header 请求下载接口，并直接获得 http.Response 响应，ctx 取消时中止下载
+func (d *Downloader) DownloadRawContext(ctx context.Context, key string, headers http.Header) (io.ReadCloser, error) {
+	return d.downloadRaw(ctx, key, headers)
 }
 
 // DownloadRangeReader 下载指定对象的指定范围为Reader
 func (d *Downloader) DownloadRangeReader(key string, offset, size int64) (l int64, reader io.ReadCloser, err error) {
-	return d.downloadRangeReader(key, offset, size)
+	return d.DownloadRangeReaderContext(context.Background(), key, offset, size)
+}
+
+// DownloadRangeReaderContext 下载指定对象的指定范围为Reader，ctx 取消时中止下载
+func (d *Downloader) DownloadRangeReaderContext(ctx context.Context, key string, offset, size int64) (l int64, reader io.ReadCloser, err error) {
+	return d.downloadRangeReader(ctx, key, offset, size)
 }
 
 // DownloadRangeBytes 下载指定对象的指定范围到内存中
 func (d *Downloader) DownloadRangeBytes(key string, offset, size int64) (l int64, data []byte, err error) {
-	return d.downloadRangeBytes(key, offset, size)
+	return d.DownloadRangeBytesContext(context.Background(), key, offset, size)
+}
+
+// DownloadRangeBytesContext 下载指定对象的指定范围到内存中，ctx 取消时中止下载
+func (d *Downloader) DownloadRangeBytesContext(ctx context.Context, key string, offset, size int64) (l int64, data []byte, err error) {
+	return d.downloadRangeBytes(ctx, key, offset, size)
 }
 
 // DownloadBytes 下载指定对象到内存中
 func (d *Downloader) DownloadBytes(key string) (data []byte, err error) {
-	return d.downloadBytes(key)
+	return d.DownloadBytesContext(context.Background(), key)
+}
+
+// DownloadBytesContext 下载指定对象到内存中，ctx 取消时中止下载
+func (d *Downloader) DownloadBytesContext(ctx context.Context, key string) (data []byte, err error) {
+	return d.downloadBytes(ctx, key)
 }
 
 // DownloadFile 下载指定对象到文件里
 func (d *Downloader) DownloadFile(key, path string) (f *os.File, err error) {
-	return d.downloadFile(key, path)
+	return d.DownloadFileContext(context.Background(), key, path)
+}
+
+// DownloadFileContext 下载指定对象到文件里，ctx 取消时中止下载
+func (d *Downloader) DownloadFileContext(ctx context.Context, key, path string) (f *os.File, err error) {
+	return d.downloadFile(ctx, key, path)
+}
+
+// DownloadFileWithProgress 下载指定对象到文件里，通过 fn 回调下载进度，ctx 取消时中止下载
+func (d *Downloader) DownloadFileWithProgress(ctx context.Context, key, path string, fn ProgressFunc) (f *os.File, err error) {
+	return d.downloadFile(withProgressFunc(ctx, fn), key, path)
+}
+
+// Open 打开指定对象用于随机读取，返回的 ObjectReader 按范围下载数据，使用完需要关闭。
+// ctx 用于之后的所有读取，ctx 取消后读取返回错误
+func (d *Downloader) Open(ctx context.Context, key string) (*ObjectReader, error) {
+	return d.open(ctx, key)
 }
@@ -0,0 +1,86 @@
+package operation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+)
+
+var (
+	// ErrNotFound 对象、存储空间或分片上传不存在
+	ErrNotFound = errors.New("not found")
+	// ErrAccessDenied 没有权限或签名错误
+	ErrAccessDenied = errors.New("access denied")
+	// ErrRangeNotSatisfiable 请求的范围超出对象大小
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+	// ErrPreconditionFailed 条件请求不满足，如 If-Match 指定的 ETag 与对象不同
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrClientNotInitialized 存储后端没有初始化
+	ErrClientNotInitialized = errors.New("client not initialized")
+	// ErrChecksumMismatch 传输的数据与校验值不一致
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrNotSupported 存储后端不支持该操作
+	ErrNotSupported = errors.New("operation not supported by backend")
+)
+
+// Error 存储服务返回的错误，可以用 errors.Is 与 ErrNotFound 等按状态码比较，
+// OBS 后端的原始错误可以用 errors.As 取出 obs.ObsError
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	// Err 原始错误
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("status %d, code %s", e.StatusCode, e.Code)
+	if e.RequestID != "" {
+		msg += ", request id " + e.RequestID
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 按状态码匹配 ErrNotFound、ErrAccessDenied、ErrRangeNotSatisfiable、ErrPreconditionFailed
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrAccessDenied:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRangeNotSatisfiable:
+		return e.StatusCode == http.StatusRequestedRangeNotSatisfiable
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// 将 OBS SDK 返回的错误转换为 *Error，其他错误原样返回
+func wrapError(err error) error {
+	var obsErr obs.ObsError
+	if err == nil || !errors.As(err, &obsErr) {
+		return err
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{
+		StatusCode: obsErr.StatusCode,
+		Code:       obsErr.Code,
+		Message:    obsErr.Message,
+		RequestID:  obsErr.RequestId,
+		Err:        err,
+	}
+}
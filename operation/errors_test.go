@@ -0,0 +1,68 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Is(t *testing.T) {
+	backend := NewMemoryBackend()
+	_, err := backend.HeadObject(context.Background(), "not-exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrAccessDenied))
+
+	err = backend.PutObject(context.Background(), "key", bytes.NewReader([]byte("data")), 4, nil)
+	assert.NoError(t, err)
+	_, err = backend.GetObject(context.Background(), "key", &GetOptions{Range: &Range{Offset: 10, Size: 1}})
+	assert.True(t, errors.Is(err, ErrRangeNotSatisfiable))
+}
+
+func TestError_OBSBackend(t *testing.T) {
+	config := getOBSTestConfig(t)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+
+	_, err = downloader.DownloadBytes("not-exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	var e *Error
+	assert.True(t, errors.As(err, &e))
+	assert.Equal(t, http.StatusNotFound, e.StatusCode)
+	assert.Equal(t, "NoSuchKey", e.Code)
+	assert.NotEmpty(t, e.RequestID)
+
+	var obsErr obs.ObsError
+	assert.True(t, errors.As(err, &obsErr))
+	assert.Equal(t, e.RequestID, obsErr.RequestId)
+
+	config.Sk = "wrong-secret-key"
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+	_, err = lister.Stat("key")
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+}
+
+func TestError_Constructors(t *testing.T) {
+	_, err := NewUploader(&Config{Type: "unknown"})
+	assert.Error(t, err)
+	_, err = NewDownloader(&Config{Backend: NewMemoryBackend(), Replicas: []*Config{{Type: "unknown"}}})
+	assert.Error(t, err)
+	_, err = NewMultiClustersLister(&MultiClustersConfig{})
+	assert.Error(t, err)
+	_, err = NewUploader(&Config{Backend: NewMemoryBackend(), Replication: &ReplicationConfig{Targets: []*Config{{Backend: NewMemoryBackend()}}, Policy: "unknown"}})
+	assert.Error(t, err)
+
+	err = (&singleClusterUploader{}).uploadData(context.Background(), nil, "key")
+	assert.Equal(t, ErrClientNotInitialized, err)
+
+	lister, err := NewLister(&Config{Backend: NewMemoryBackend()})
+	assert.NoError(t, err)
+	_, err = lister.StatBucket()
+	assert.Equal(t, ErrNotSupported, err)
+}
@@ -41,8 +41,9 @@ func (pool *GoroutinePool) Go(worker func(context.Context) error) {
 
 // Wait waits for all workers to finish.
 // If any worker returns an error, it will return the error.
+// If ctx is canceled, the remaining workers are skipped and ctx.Err() is returned.
 func (pool *GoroutinePool) Wait(ctx context.Context) error {
-	group, ctx := errgroup.WithContext(ctx)
+	group, groupCtx := errgroup.WithContext(ctx)
 	workersChan := make(chan func(context.Context) error)
 
 	// 取worker的数量与最大协程数中的最小值作为consumerCount
@@ -56,7 +57,10 @@ func (pool *GoroutinePool) Wait(ctx context.Context) error {
 	for i := 0; i < consumerCount; i++ {
 		group.Go(func() error {
 			for worker := range workersChan {
-				if err := worker(ctx); err != nil {
+				if err := groupCtx.Err(); err != nil {
+					return err
+				}
+				if err := worker(groupCtx); err != nil {
 					return err
 				}
 			}
@@ -65,10 +69,19 @@ func (pool *GoroutinePool) Wait(ctx context.Context) error {
 	}
 
 	// worker producer
+	// 有 worker 出错或 ctx 被取消后不再分发剩余的 worker，避免所有 consumer 退出后阻塞
+produce:
 	for _, worker := range pool.workers {
-		workersChan <- worker
+		select {
+		case workersChan <- worker:
+		case <-groupCtx.Done():
+			break produce
+		}
 	}
 	close(workersChan)
 
-	return group.Wait()
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
 }
@@ -0,0 +1,40 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoroutinePool_Error(t *testing.T) {
+	var count int32
+	pool := NewGoroutinePool(1)
+	for i := 0; i < 10; i++ {
+		pool.Go(func(ctx context.Context) error {
+			atomic.AddInt32(&count, 1)
+			return errors.New("failed")
+		})
+	}
+	assert.EqualError(t, pool.Wait(context.Background()), "failed")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestGoroutinePool_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var count int32
+	pool := NewGoroutinePool(2)
+	for i := 0; i < 10; i++ {
+		pool.Go(func(ctx context.Context) error {
+			if atomic.AddInt32(&count, 1) == 1 {
+				cancel()
+			}
+			return nil
+		})
+	}
+	assert.Equal(t, context.Canceled, pool.Wait(ctx))
+	assert.True(t, atomic.LoadInt32(&count) < 10)
+}
@@ -14,6 +14,7 @@ type clusterLister interface {
 	delete(ctx context.Context, key string) error
 	stat(ctx context.Context, key string) (*Entry, error)
 	statBucket(ctx context.Context) (*obs.GetBucketMetadataOutput, error)
+	abortUploads(ctx context.Context, opts AbortUploadsOptions) (*AbortUploadsResult, error)
 }
 
 // Lister 列举器
@@ -21,40 +22,96 @@ type Lister struct {
 	clusterLister
 }
 
-// ListPrefix 根据前缀列举存储空间
-func (l *Lister) ListPrefix(prefix string) []string {
-	keys, err := l.listPrefix(context.Background(), prefix)
+// NewLister 根据配置创建列举器
+func NewLister(c *Config) (*Lister, error) {
+	lister, err := newSingleClusterLister(c)
 	if err != nil {
-		return []string{}
+		return nil, err
 	}
-	return keys
+	return &Lister{lister}, nil
 }
 
-// ListStat 获取指定对象列表的元信息
-func (l *Lister) ListStat(keys []string) []*FileStat {
-	fileStats, err := l.listStat(context.Background(), keys)
+// NewMultiClustersLister 根据多集群配置创建列举器，按路由规则将 key 分配到各个集群
+func NewMultiClustersLister(c *MultiClustersConfig) (*Lister, error) {
+	lister, err := newMultiClustersLister(c)
 	if err != nil {
-		return []*FileStat{}
+		return nil, err
 	}
-	return fileStats
+	return &Lister{lister}, nil
+}
+
+// ListPrefix 根据前缀列举存储空间
+func (l *Lister) ListPrefix(prefix string) ([]string, error) {
+	return l.ListPrefixContext(context.Background(), prefix)
+}
+
+// ListPrefixContext 根据前缀列举存储空间，ctx 取消时中止列举
+func (l *Lister) ListPrefixContext(ctx context.Context, prefix string) ([]string, error) {
+	return l.listPrefix(ctx, prefix)
+}
+
+// ListPrefixToChannel 根据前缀列举存储空间，结果逐个写入 output，ctx 取消时中止列举
+func (l *Lister) ListPrefixToChannel(ctx context.Context, prefix string, output chan<- string) error {
+	return l.listPrefixToChannel(ctx, prefix, output)
+}
+
+// ListStat 获取指定对象列表的元信息，获取失败的对象 Size 为 -1，失败原因见 FileStat.Code 和 FileStat.Err
+func (l *Lister) ListStat(keys []string) ([]*FileStat, error) {
+	return l.ListStatContext(context.Background(), keys)
+}
+
+// ListStatContext 获取指定对象列表的元信息，ctx 取消时中止请求
+func (l *Lister) ListStatContext(ctx context.Context, keys []string) ([]*FileStat, error) {
+	return l.listStat(ctx, keys)
 }
 
 // DeleteKeys 删除多个对象
 func (l *Lister) DeleteKeys(keys []string) ([]*DeleteKeysError, error) {
-	return l.deleteKeys(context.Background(), keys)
+	return l.DeleteKeysContext(context.Background(), keys)
+}
+
+// DeleteKeysContext 删除多个对象，ctx 取消时中止请求
+func (l *Lister) DeleteKeysContext(ctx context.Context, keys []string) ([]*DeleteKeysError, error) {
+	return l.deleteKeys(ctx, keys)
 }
 
 // Delete 删除指定对象
 func (l *Lister) Delete(key string) error {
-	return l.delete(context.Background(), key)
+	return l.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext 删除指定对象，ctx 取消时中止请求
+func (l *Lister) DeleteContext(ctx context.Context, key string) error {
+	return l.delete(ctx, key)
 }
 
 // Stat 获取对象元数据
 func (l *Lister) Stat(key string) (*Entry, error) {
-	return l.stat(context.Background(), key)
+	return l.StatContext(context.Background(), key)
+}
+
+// StatContext 获取对象元数据，ctx 取消时中止请求
+func (l *Lister) StatContext(ctx context.Context, key string) (*Entry, error) {
+	return l.stat(ctx, key)
 }
 
 // StatBucket 获取桶元数据
 func (l *Lister) StatBucket() (*obs.GetBucketMetadataOutput, error) {
-	return l.statBucket(context.Background())
+	return l.StatBucketContext(context.Background())
+}
+
+// StatBucketContext 获取桶元数据，ctx 取消时中止请求
+func (l *Lister) StatBucketContext(ctx context.Context) (*obs.GetBucketMetadataOutput, error) {
+	return l.statBucket(ctx)
+}
+
+// AbortMultipartUploads 清理符合条件的未完成的分片上传，释放其占用的存储空间
+// 单个分片上传的失败记录在 AbortedUpload.Err 中，后端不支持列举分片上传时返回 ErrNotSupported
+func (l *Lister) AbortMultipartUploads(opts AbortUploadsOptions) (*AbortUploadsResult, error) {
+	return l.AbortMultipartUploadsContext(context.Background(), opts)
+}
+
+// AbortMultipartUploadsContext 清理符合条件的未完成的分片上传，ctx 取消时中止清理
+func (l *Lister) AbortMultipartUploadsContext(ctx context.Context, opts AbortUploadsOptions) (*AbortUploadsResult, error) {
+	return l.abortUploads(ctx, opts)
 }
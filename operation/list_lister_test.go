@@ -16,10 +16,12 @@ func TestListPrefix(t *testing.T) {
 	lister := getClearedListerForTest(t)
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
-	result := lister.ListPrefix("")
-	_, err := lister.DeleteKeys(result)
+	result, err := lister.ListPrefix("")
+	assert.NoError(t, err)
+	_, err = lister.DeleteKeys(result)
 	assert.NoError(t, err)
 
 	err = uploader.UploadData([]byte("test1"), "test1")
@@ -28,7 +30,8 @@ func TestListPrefix(t *testing.T) {
 	err = uploader.UploadData([]byte("test2"), "test2")
 	assert.NoError(t, err)
 
-	result = lister.ListPrefix("")
+	result, err = lister.ListPrefix("")
+	assert.NoError(t, err)
 	assert.Contains(t, result, "test1")
 	assert.Contains(t, result, "test2")
 }
@@ -37,7 +40,8 @@ func TestLister_ListStat(t *testing.T) {
 	lister := getClearedListerForTest(t)
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	type TestCase struct {
 		name    string
@@ -63,7 +67,8 @@ func TestLister_ListStat(t *testing.T) {
 	defer lister.DeleteKeys(keys)
 
 	// 列举出所有文件的stat
-	fileStats := lister.ListStat(keys)
+	fileStats, err := lister.ListStat(keys)
+	assert.NoError(t, err)
 
 	for i, stat := range fileStats {
 		assert.Equal(t, testCases[i].name, stat.Name)
@@ -75,15 +80,17 @@ func TestLister_Delete(t *testing.T) {
 	lister := getClearedListerForTest(t)
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	// 创建文件 test1
-	err := uploader.UploadData([]byte("test1"), "test1")
+	err = uploader.UploadData([]byte("test1"), "test1")
 	defer lister.Delete("test1")
 	assert.NoError(t, err)
 
 	// 列举出所有文件
-	result := lister.ListPrefix("")
+	result, err := lister.ListPrefix("")
+	assert.NoError(t, err)
 	assert.NotEmpty(t, result)
 
 	// 测试文件 test1 应当存在
@@ -94,7 +101,8 @@ func TestLister_Delete(t *testing.T) {
 	assert.NoError(t, err)
 
 	// 列举出所有文件
-	result = lister.ListPrefix("")
+	result, err = lister.ListPrefix("")
+	assert.NoError(t, err)
 
 	// 测试文件 test1 应当不存在
 	assert.NotContains(t, result, "test1")
@@ -104,7 +112,8 @@ func TestLister_DeleteKeys(t *testing.T) {
 	lister := getClearedListerForTest(t)
 	config := getConfig1()
 
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	type TestCase struct {
 		name    string
@@ -121,7 +130,8 @@ func TestLister_DeleteKeys(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	result := lister.ListPrefix("")
+	result, err := lister.ListPrefix("")
+	assert.NoError(t, err)
 
 	// 提取keys，并验证每个key是否存在于result中
 	keys := make([]string, len(testCases))
@@ -134,7 +144,8 @@ func TestLister_DeleteKeys(t *testing.T) {
 	lister.DeleteKeys(keys)
 
 	// 删除结束后每个key都不存在result中了
-	result = lister.ListPrefix("")
+	result, err = lister.ListPrefix("")
+	assert.NoError(t, err)
 
 	for _, key := range keys {
 		assert.NotContains(t, result, key)
@@ -143,7 +154,8 @@ func TestLister_DeleteKeys(t *testing.T) {
 
 func makeLotsFilesWithPrefix(t *testing.T, files uint, batchConcurrency int, prefix string) (paths []string) {
 	config := getConfig1()
-	uploader := NewUploader(config)
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
 
 	pool := NewGoroutinePool(batchConcurrency)
 	for i := uint(0); i < files; i++ {
@@ -154,7 +166,7 @@ func makeLotsFilesWithPrefix(t *testing.T, files uint, batchConcurrency int, pre
 			})
 		}(i)
 	}
-	err := pool.Wait(context.Background())
+	err = pool.Wait(context.Background())
 	assert.NoError(t, err)
 
 	// 文件列表
@@ -172,11 +184,12 @@ func TestDeleteLotsFile(t *testing.T) {
 	lister := getClearedListerForTest(t)
 	makeLotsFiles(t, 2000, 500)
 
-	paths := lister.ListPrefix("")
+	paths, err := lister.ListPrefix("")
+	assert.NoError(t, err)
 	assert.Equal(t, 2000, len(paths))
-	_, err := lister.DeleteKeys(paths)
+	_, err = lister.DeleteKeys(paths)
 	assert.NoError(t, err)
-	assert.Empty(t, lister.ListPrefix(""))
+	assert.Empty(t, mustListPrefix(t, lister, ""))
 }
 
 func TestListStatLotsFile(t *testing.T) {
@@ -185,6 +198,13 @@ func TestListStatLotsFile(t *testing.T) {
 
 	paths := makeLotsFiles(t, 2000, 500)
 	defer lister.DeleteKeys(paths)
-	stats := lister.ListStat(paths)
+	stats, err := lister.ListStat(paths)
+	assert.NoError(t, err)
 	assert.Equal(t, 2000, len(stats))
 }
+
+func mustListPrefix(t *testing.T, lister *Lister, prefix string) []string {
+	keys, err := lister.ListPrefix(prefix)
+	assert.NoError(t, err)
+	return keys
+}
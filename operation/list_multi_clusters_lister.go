@@ -0,0 +1,242 @@
+package operation
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+)
+
+type multiClustersLister struct {
+	config  *MultiClustersConfig
+	listers []*singleClusterLister
+}
+
+func newMultiClustersLister(c *MultiClustersConfig) (*multiClustersLister, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	listers := make([]*singleClusterLister, len(c.Clusters))
+	for i, cluster := range c.Clusters {
+		lister, err := newSingleClusterLister(cluster.Config)
+		if err != nil {
+			return nil, err
+		}
+		listers[i] = lister
+	}
+	return &multiClustersLister{config: c, listers: listers}, nil
+}
+
+func (l *multiClustersLister) forKey(key string) (*singleClusterLister, error) {
+	index, err := l.config.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return l.listers[index], nil
+}
+
+// 并发列举所有可能存放该前缀的集群，只输出按路由规则属于该集群的 key，
+// 避免多个集群共用同一个存储空间时重复列举
+func (l *multiClustersLister) listPrefixToChannel(ctx context.Context, prefix string, ch chan<- string) error {
+	pool := NewGoroutinePoolWithoutLimit()
+	for _, index := range l.config.forPrefix(prefix) {
+		func(index int) {
+			pool.Go(func(ctx context.Context) error {
+				marker := ""
+				for {
+					entries, _, markerOut, err := l.listers[index].list(ctx, prefix, "", marker, 1000)
+					if err != nil && err != io.EOF {
+						return err
+					}
+					for _, entry := range entries {
+						if i, err := l.config.forKey(entry.Key); err != nil || i != index {
+							continue
+						}
+						select {
+						case ch <- entry.Key:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+					if markerOut == "" {
+						return nil
+					}
+					marker = markerOut
+				}
+			})
+		}(index)
+	}
+	return pool.Wait(ctx)
+}
+
+func (l *multiClustersLister) listPrefix(ctx context.Context, prefix string) (files []string, err error) {
+	ch := make(chan string, 1000)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for c := range ch {
+			files = append(files, c)
+		}
+	}()
+
+	err = l.listPrefixToChannel(ctx, prefix, ch)
+	close(ch)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (l *multiClustersLister) listStat(ctx context.Context, keys []string) ([]*FileStat, error) {
+	groups, err := l.config.groupKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stats = make([]*FileStat, len(keys))
+		pool  = NewGoroutinePoolWithoutLimit()
+	)
+	for index, indexes := range groups {
+		func(lister *singleClusterLister, indexes []int) {
+			pool.Go(func(ctx context.Context) error {
+				subKeys := make([]string, len(indexes))
+				for i, j := range indexes {
+					subKeys[i] = keys[j]
+				}
+				subStats, err := lister.listStat(ctx, subKeys)
+				if err != nil {
+					return err
+				}
+				for i, j := range indexes {
+					stats[j] = subStats[i]
+				}
+				return nil
+			})
+		}(l.listers[index], indexes)
+	}
+
+	if err := pool.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// 返回的错误列表与 keys 一一对应，删除成功的位置为 nil
+func (l *multiClustersLister) deleteKeys(ctx context.Context, keys []string) ([]*DeleteKeysError, error) {
+	groups, err := l.config.groupKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		errs = make([]*DeleteKeysError, len(keys))
+		pool = NewGoroutinePoolWithoutLimit()
+	)
+	for index, indexes := range groups {
+		func(lister *singleClusterLister, indexes []int) {
+			pool.Go(func(ctx context.Context) error {
+				positions := make(map[string]int, len(indexes))
+				subKeys := make([]string, len(indexes))
+				for i, j := range indexes {
+					subKeys[i] = keys[j]
+					positions[keys[j]] = j
+				}
+				subErrs, err := lister.deleteKeys(ctx, subKeys)
+				if err != nil {
+					return err
+				}
+				for _, e := range subErrs {
+					if e == nil {
+						continue
+					}
+					if j, ok := positions[e.Name]; ok {
+						errs[j] = e
+					}
+				}
+				return nil
+			})
+		}(l.listers[index], indexes)
+	}
+
+	if err := pool.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (l *multiClustersLister) delete(ctx context.Context, key string) error {
+	lister, err := l.forKey(key)
+	if err != nil {
+		return err
+	}
+	return lister.delete(ctx, key)
+}
+
+func (l *multiClustersLister) stat(ctx context.Context, key string) (*Entry, error) {
+	lister, err := l.forKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return lister.stat(ctx, key)
+}
+
+// 检查所有集群的存储空间，全部可用时返回第一个集群的元数据
+func (l *multiClustersLister) statBucket(ctx context.Context) (*obs.GetBucketMetadataOutput, error) {
+	var first *obs.GetBucketMetadataOutput
+	for i, lister := range l.listers {
+		output, err := lister.statBucket(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			first = output
+		}
+	}
+	return first, nil
+}
+
+// 清理所有可能存放该前缀的集群，每个集群只清理按路由规则属于该集群的对象上的分片上传，
+// 避免多个集群共用同一个存储空间时重复清理
+func (l *multiClustersLister) abortUploads(ctx context.Context, opts AbortUploadsOptions) (*AbortUploadsResult, error) {
+	indexes := l.config.forPrefix(opts.Prefix)
+	var (
+		results = make([]*AbortUploadsResult, len(indexes))
+		pool    = NewGoroutinePoolWithoutLimit()
+	)
+	for i, index := range indexes {
+		func(i, index int) {
+			pool.Go(func(ctx context.Context) (err error) {
+				results[i], err = l.listers[index].abortUploadsFor(ctx, opts, func(key string) bool {
+					j, err := l.config.forKey(key)
+					return err == nil && j == index
+				})
+				return
+			})
+		}(i, index)
+	}
+	if err := pool.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	merged := &AbortUploadsResult{}
+	for _, result := range results {
+		merged.Uploads = append(merged.Uploads, result.Uploads...)
+		merged.Size += result.Size
+	}
+	sort.Slice(merged.Uploads, func(i, j int) bool {
+		if merged.Uploads[i].Key != merged.Uploads[j].Key {
+			return merged.Uploads[i].Key < merged.Uploads[j].Key
+		}
+		return merged.Uploads[i].Initiated.Before(merged.Uploads[j].Initiated)
+	})
+	return merged, nil
+}
@@ -0,0 +1,117 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiClusters(t *testing.T) {
+	backends := []*MemoryBackend{NewMemoryBackend(), NewMemoryBackend()}
+	config := &MultiClustersConfig{
+		Clusters: []*ClusterConfig{
+			{Config: &Config{Bucket: "hot", Backend: backends[0]}, Prefixes: []string{"hot/"}},
+			{Config: &Config{Bucket: "cold", Backend: backends[1]}, Prefixes: []string{""}},
+		},
+	}
+	ctx := context.Background()
+	uploader, err := NewMultiClustersUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewMultiClustersDownloader(config)
+	assert.NoError(t, err)
+	lister, err := NewMultiClustersLister(config)
+	assert.NoError(t, err)
+
+	keys := []string{"cold/1", "hot/1", "hot/2", "other"}
+	for _, key := range keys {
+		err := uploader.UploadData([]byte(key), key)
+		assert.NoError(t, err)
+	}
+
+	// 按前缀写入对应的集群
+	_, err = backends[0].HeadObject(ctx, "hot/1")
+	assert.NoError(t, err)
+	_, err = backends[1].HeadObject(ctx, "hot/1")
+	assert.Error(t, err)
+	_, err = backends[1].HeadObject(ctx, "other")
+	assert.NoError(t, err)
+
+	data, err := downloader.DownloadBytes("hot/2")
+	assert.NoError(t, err)
+	assert.Equal(t, "hot/2", string(data))
+	r, err := downloader.Open(ctx, "other")
+	assert.NoError(t, err)
+	data, err = io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "other", string(data))
+	r.Close()
+
+	assert.Equal(t, keys, mustListPrefix(t, lister, ""))
+	assert.Equal(t, []string{"hot/1", "hot/2"}, mustListPrefix(t, lister, "hot/"))
+
+	stats, err := lister.ListStat([]string{"hot/1", "other", "hot/not-exist"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stats[0].Size)
+	assert.Equal(t, int64(5), stats[1].Size)
+	assert.Equal(t, int64(-1), stats[2].Size)
+
+	// 不属于该集群的 key 不会被列举出来
+	err = backends[1].PutObject(ctx, "hot/stale", strings.NewReader(""), 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hot/1", "hot/2"}, mustListPrefix(t, lister, "hot/"))
+
+	backends[0].SetDeleteError("hot/1", "AccessDenied", "denied")
+	errs, err := lister.DeleteKeys(keys)
+	assert.NoError(t, err)
+	assert.Len(t, errs, len(keys))
+	for i, e := range errs {
+		if keys[i] == "hot/1" {
+			assert.Equal(t, "AccessDenied", e.Code, fmt.Sprint(i))
+		} else {
+			assert.Nil(t, e, keys[i])
+		}
+	}
+	assert.Equal(t, []string{"hot/1"}, mustListPrefix(t, lister, ""))
+}
+
+func TestMultiClusters_AbortMultipartUploads(t *testing.T) {
+	shared := NewMemoryBackend()
+	config := &MultiClustersConfig{
+		Clusters: []*ClusterConfig{
+			{Config: &Config{Bucket: "shared", Backend: shared}, Prefixes: []string{"hot/"}},
+			{Config: &Config{Bucket: "shared", Backend: shared}, Prefixes: []string{""}},
+		},
+	}
+	lister, err := NewMultiClustersLister(config)
+	assert.NoError(t, err)
+
+	initiateUpload(t, shared, "hot/1", 10)
+	initiateUpload(t, shared, "cold/1", 20)
+
+	// 共用存储空间时每个分片上传只统计一次
+	result, err := lister.AbortMultipartUploads(AbortUploadsOptions{DryRun: true})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Uploads, 2) {
+		assert.Equal(t, "cold/1", result.Uploads[0].Key)
+		assert.Equal(t, "hot/1", result.Uploads[1].Key)
+	}
+	assert.Equal(t, int64(30), result.Size)
+
+	result, err = lister.AbortMultipartUploads(AbortUploadsOptions{OlderThan: time.Hour})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Uploads)
+
+	result, err = lister.AbortMultipartUploads(AbortUploadsOptions{Prefix: "hot/"})
+	assert.NoError(t, err)
+	assert.Len(t, result.Uploads, 1)
+	uploads, err := shared.ListMultipartUploads(context.Background(), "")
+	assert.NoError(t, err)
+	if assert.Len(t, uploads, 1) {
+		assert.Equal(t, "cold/1", uploads[0].Key)
+	}
+}
@@ -2,10 +2,10 @@ package operation
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"io"
+	"sort"
 	"sync"
+	"time"
 
 	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
 )
@@ -14,21 +14,24 @@ type singleClusterLister struct {
 	bucket           string
 	batchConcurrency int
 	batchSize        int
-	client           *obs.ObsClient
+	backend          Backend
+	retry            *RetryPolicy
+	telemetry        *telemetry
 }
 
-func newSingleClusterLister(c *Config) *singleClusterLister {
-	obsClient, err := obs.New(c.Ak, c.Sk, c.EndPoint)
-
+func newSingleClusterLister(c *Config) (*singleClusterLister, error) {
+	backend, err := newBackend(c)
 	if err != nil {
-		fmt.Printf("Create obsClient error, errMsg: %s\n", err.Error())
+		return nil, err
 	}
 
 	lister := singleClusterLister{
 		bucket:           c.Bucket,
-		client:           obsClient,
+		backend:          backend,
 		batchSize:        c.BatchSize,
 		batchConcurrency: c.BatchConcurrency,
+		retry:            newRetryPolicy(c.RetryPolicy),
+		telemetry:        newTelemetry(c),
 	}
 
 	if lister.batchConcurrency <= 0 {
@@ -38,12 +41,16 @@ func newSingleClusterLister(c *Config) *singleClusterLister {
 		lister.batchSize = 100
 	}
 
-	return &lister
-
+	return &lister, nil
 }
 
 // 列举指定前缀的文件到channel中
-func (l *singleClusterLister) listPrefixToChannel(ctx context.Context, prefix string, ch chan<- string) error {
+func (l *singleClusterLister) listPrefixToChannel(ctx context.Context, prefix string, ch chan<- string) (err error) {
+	ctx, span := l.telemetry.span(ctx, "list_prefix", "bucket", l.bucket, "prefix", prefix)
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	marker := ""
 	for {
 		res, markerOut, err := func() (res []ListItem, markerOut string, err error) {
@@ -59,7 +66,11 @@ func (l *singleClusterLister) listPrefixToChannel(ctx context.Context, prefix st
 		}
 
 		for _, item := range res {
-			ch <- item.Key
+			select {
+			case ch <- item.Key:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 
 		if markerOut == "" {
@@ -93,38 +104,47 @@ func (l *singleClusterLister) listPrefix(ctx context.Context, prefix string) (fi
 	return files, nil
 }
 
+// 按重试策略执行一次操作，并记录日志、指标和链路追踪，fields 为交替出现的字段名和值
+func (l *singleClusterLister) do(ctx context.Context, op string, fields []interface{}, fn func(ctx context.Context) error) error {
+	ctx, run := l.telemetry.start(ctx, op, fields...)
+	err := l.retry.do(ctx, run.log, fn)
+	run.end(0, err)
+	return err
+}
+
 func (l *singleClusterLister) list(ctx context.Context, prefix, delimiter, marker string, limit int) (entries []ListItem, commonPrefixes []string, markerOut string, err error) {
 
-	if l.client == nil {
-		return nil, nil, "", errors.New("obsclient is nil")
+	if l.backend == nil {
+		return nil, nil, "", ErrClientNotInitialized
 	}
 
-	input := &obs.ListObjectsInput{}
-	input.Bucket = l.bucket
-	input.Prefix = prefix
-	input.Delimiter = delimiter
-	input.Marker = marker
-	input.MaxKeys = limit
-	input.EncodingType = "url"
-	output, err := l.client.ListObjects(input)
+	err = l.do(ctx, OpListPage, []interface{}{"prefix", prefix, "marker", marker}, func(ctx context.Context) (err error) {
+		entries, commonPrefixes, markerOut, err = l.backend.ListObjects(ctx, prefix, delimiter, marker, limit)
+		return
+	})
 
 	if err != nil {
 		return
 	}
 
-	if output.NextMarker == "" {
-		return convertListItem(output.Contents), output.CommonPrefixes, "", io.EOF
+	if markerOut == "" {
+		return entries, commonPrefixes, "", io.EOF
 	}
 
-	return convertListItem(output.Contents), output.CommonPrefixes, output.NextMarker, nil
+	return entries, commonPrefixes, markerOut, nil
 }
 
-func (l *singleClusterLister) listStat(ctx context.Context, paths []string) ([]*FileStat, error) {
+func (l *singleClusterLister) listStat(ctx context.Context, paths []string) (_ []*FileStat, err error) {
 
-	if l.client == nil {
-		return nil, errors.New("obsclient is nil")
+	if l.backend == nil {
+		return nil, ErrClientNotInitialized
 	}
 
+	ctx, span := l.telemetry.span(ctx, "list_stat", "bucket", l.bucket, "keys", len(paths))
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	// 并发数计算
 	concurrency := (len(paths) + l.batchSize - 1) / l.batchSize
 	if concurrency > l.batchConcurrency {
@@ -146,23 +166,28 @@ func (l *singleClusterLister) listStat(ctx context.Context, paths []string) ([]*
 		// index 是这批文件的起始位置
 		func(paths []string, index int) {
 			pool.Go(func(ctx context.Context) error {
+				ctx, span := l.telemetry.span(ctx, "stat_batch", "bucket", l.bucket, "index", index, "keys", len(paths))
+				defer span.End()
+
 				func() {
 					for j, key := range paths {
-						input := &obs.GetObjectMetadataInput{}
-						input.Bucket = l.bucket
-						input.Key = key
-						output, _ := l.client.GetObjectMetadata(input)
-						if output.StatusCode <= 300 {
+						var entry *Entry
+						err := l.do(ctx, OpStat, []interface{}{"key", key}, func(ctx context.Context) (err error) {
+							entry, err = l.backend.HeadObject(ctx, key)
+							return
+						})
+						if err == nil {
 							stats[index+j] = &FileStat{
 								Name: key,
-								Size: output.ContentLength,
-								code: output.StatusCode,
+								Size: entry.Fsize,
+								Code: 200,
 							}
 						} else {
 							stats[index+j] = &FileStat{
 								Name: paths[j],
 								Size: -1,
-								code: output.StatusCode,
+								Code: statusCodeOf(err),
+								Err:  err,
 							}
 						}
 					}
@@ -180,12 +205,17 @@ func (l *singleClusterLister) listStat(ctx context.Context, paths []string) ([]*
 	return stats, nil
 }
 
-func (l *singleClusterLister) deleteKeys(ctx context.Context, paths []string) ([]*DeleteKeysError, error) {
+func (l *singleClusterLister) deleteKeys(ctx context.Context, paths []string) (_ []*DeleteKeysError, err error) {
 
-	if l.client == nil {
-		return nil, errors.New("obsclient is nil")
+	if l.backend == nil {
+		return nil, ErrClientNotInitialized
 	}
 
+	ctx, span := l.telemetry.span(ctx, "delete_keys", "bucket", l.bucket, "keys", len(paths))
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	// 并发数计算
 	concurrency := (len(paths) + l.batchSize - 1) / l.batchSize
 	if concurrency > l.batchConcurrency {
@@ -207,26 +237,25 @@ func (l *singleClusterLister) deleteKeys(ctx context.Context, paths []string) ([
 		// index 是这批文件的起始位置
 		func(paths []string, index int) {
 			pool.Go(func(ctx context.Context) error {
-				res, _ := func() ([]obs.Error, error) {
-					input := &obs.DeleteObjectsInput{}
-					input.Bucket = l.bucket
-					objects := make([]obs.ObjectToDelete, len(paths))
-					for index, obj := range paths {
-						objects[index] = obs.ObjectToDelete{Key: obj}
-					}
-					input.Objects = objects[:]
-					output, err := l.client.DeleteObjects(input)
-
-					if err == nil {
-						return output.Errors, nil
+				var res []*DeleteKeysError
+				err := l.do(ctx, OpDeleteBatch, []interface{}{"index", index, "keys", len(paths)}, func(ctx context.Context) (err error) {
+					res, err = l.backend.DeleteObjects(ctx, paths)
+					return
+				})
+				if err != nil {
+					return err
+				}
+				// DeleteObjects 只返回删除失败的对象，按 key 找回在 paths 中的位置
+				positions := make(map[string]int, len(paths))
+				for j, key := range paths {
+					positions[key] = index + j
+				}
+				for _, v := range res {
+					if v == nil {
+						continue
 					}
-					return nil, err
-				}()
-				for j, v := range res {
-					errors[index+j] = &DeleteKeysError{
-						Name:    v.Key,
-						Message: v.Message,
-						Code:    v.Code,
+					if j, ok := positions[v.Name]; ok {
+						errors[j] = v
 					}
 				}
 				return nil
@@ -245,44 +274,154 @@ func (l *singleClusterLister) deleteKeys(ctx context.Context, paths []string) ([
 
 func (l *singleClusterLister) delete(ctx context.Context, key string) (err error) {
 
-	if l.client == nil {
-		return errors.New("obsclient is nil")
+	if l.backend == nil {
+		return ErrClientNotInitialized
 	}
 
-	input := &obs.DeleteObjectInput{}
-	input.Bucket = l.bucket
-	input.Key = key
-	_, err = l.client.DeleteObject(input)
-	return err
+	return l.do(ctx, OpDelete, []interface{}{"key", key}, func(ctx context.Context) error {
+		return l.backend.DeleteObject(ctx, key)
+	})
 }
 
 func (l *singleClusterLister) stat(ctx context.Context, key string) (*Entry, error) {
 
-	if l.client == nil {
-		return nil, errors.New("obsclient is nil")
+	if l.backend == nil {
+		return nil, ErrClientNotInitialized
+	}
+
+	var entry *Entry
+	err := l.do(ctx, OpStat, []interface{}{"key", key}, func(ctx context.Context) (err error) {
+		entry, err = l.backend.HeadObject(ctx, key)
+		return
+	})
+	return entry, err
+}
+
+func (l *singleClusterLister) statBucket(ctx context.Context) (*obs.GetBucketMetadataOutput, error) {
+	if l.backend == nil {
+		return nil, ErrClientNotInitialized
+	}
+
+	stater, ok := l.backend.(interface {
+		StatBucket(ctx context.Context) (*obs.GetBucketMetadataOutput, error)
+	})
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	var output *obs.GetBucketMetadataOutput
+	err := l.do(ctx, OpStatBucket, nil, func(ctx context.Context) (err error) {
+		output, err = stater.StatBucket(ctx)
+		return
+	})
+	return output, err
+}
+
+func (l *singleClusterLister) abortUploads(ctx context.Context, opts AbortUploadsOptions) (*AbortUploadsResult, error) {
+	return l.abortUploadsFor(ctx, opts, nil)
+}
+
+// 清理未完成的分片上传，keep 不为 nil 时只清理 keep 返回 true 的对象上的分片上传。
+// 分批并发列举每个分片上传已上传的分片，非 DryRun 时随后取消分片上传
+func (l *singleClusterLister) abortUploadsFor(ctx context.Context, opts AbortUploadsOptions, keep func(key string) bool) (_ *AbortUploadsResult, err error) {
+
+	if l.backend == nil {
+		return nil, ErrClientNotInitialized
+	}
+	lister, ok := l.backend.(MultipartLister)
+	if !ok {
+		return nil, ErrNotSupported
 	}
 
-	input := &obs.GetObjectMetadataInput{}
-	input.Bucket = l.bucket
-	input.Key = key
-	output, err := l.client.GetObjectMetadata(input)
+	ctx, span := l.telemetry.span(ctx, "abort_uploads", "bucket", l.bucket, "prefix", opts.Prefix, "dry_run", opts.DryRun)
+	defer func() {
+		endSpan(span, err)
+	}()
 
+	var all []MultipartUpload
+	err = l.do(ctx, OpListUploads, []interface{}{"prefix", opts.Prefix}, func(ctx context.Context) (err error) {
+		all, err = lister.ListMultipartUploads(ctx, opts.Prefix)
+		return
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &Entry{
-		Hash:     output.ETag,
-		Fsize:    output.ContentLength,
-		PutTime:  output.LastModified,
-		MimeType: output.ContentType,
-		EndUser:  "",
-	}, nil
-}
 
-func (l *singleClusterLister) statBucket(ctx context.Context) (*obs.GetBucketMetadataOutput, error) {
-	if l.client == nil {
-		return nil, errors.New("obsclient is nil")
+	deadline := time.Now().Add(-opts.OlderThan)
+	var uploads []*AbortedUpload
+	for _, upload := range all {
+		if upload.Initiated.After(deadline) || (keep != nil && !keep(upload.Key)) {
+			continue
+		}
+		uploads = append(uploads, &AbortedUpload{MultipartUpload: upload})
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Key != uploads[j].Key {
+			return uploads[i].Key < uploads[j].Key
+		}
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	span.SetAttributes(Attribute{Key: "uploads", Value: len(uploads)})
+
+	// 并发数计算
+	concurrency := (len(uploads) + l.batchSize - 1) / l.batchSize
+	if concurrency > l.batchConcurrency {
+		concurrency = l.batchConcurrency
+	}
+	pool := NewGoroutinePool(concurrency)
+	// 分批处理
+	for i := 0; i < len(uploads); i += l.batchSize {
+		size := l.batchSize
+		if size > len(uploads)-i {
+			size = len(uploads) - i
+		}
+
+		func(uploads []*AbortedUpload, index int) {
+			pool.Go(func(ctx context.Context) error {
+				ctx, span := l.telemetry.span(ctx, "abort_batch", "bucket", l.bucket, "index", index, "uploads", len(uploads))
+				defer span.End()
+
+				for _, upload := range uploads {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					l.abortUpload(ctx, lister, upload, opts.DryRun)
+				}
+				return nil
+			})
+		}(uploads[i:i+size], i)
+	}
+
+	// 等待所有的批量任务完成，ctx 取消时直接结束返回错误
+	if err := pool.Wait(ctx); err != nil {
+		return nil, err
 	}
 
-	return l.client.GetBucketMetadata(&obs.GetBucketMetadataInput{Bucket: l.bucket})
+	result := &AbortUploadsResult{Uploads: uploads}
+	for _, upload := range uploads {
+		result.Size += upload.Size
+	}
+	span.SetAttributes(Attribute{Key: "bytes", Value: result.Size})
+	return result, nil
+}
+
+// 统计分片上传已上传的字节数，非 dryRun 时取消分片上传，失败原因记录在 upload.Err 中
+func (l *singleClusterLister) abortUpload(ctx context.Context, lister MultipartLister, upload *AbortedUpload, dryRun bool) {
+	fields := []interface{}{"key", upload.Key, "upload_id", upload.UploadID}
+	var parts []Part
+	upload.Err = l.do(ctx, OpListParts, fields, func(ctx context.Context) (err error) {
+		parts, err = lister.ListParts(ctx, upload.Key, upload.UploadID)
+		return
+	})
+	if upload.Err != nil {
+		return
+	}
+	for _, part := range parts {
+		upload.Size += part.Size
+	}
+	if dryRun {
+		return
+	}
+	upload.Err = l.do(ctx, OpAbortUpload, fields, func(ctx context.Context) error {
+		return l.backend.AbortMultipartUpload(ctx, upload.Key, upload.UploadID)
+	})
 }
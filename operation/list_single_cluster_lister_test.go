@@ -3,50 +3,33 @@ package operation
 import (
 	"context"
 	"fmt"
-	"sync"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func getClearedSingleClusterListerForTest(t *testing.T) *singleClusterLister {
-	checkSkipTest(t)
-	l := newSingleClusterLister(getConfig1())
+	l, err := newSingleClusterLister(getConfig1())
+	assert.NoError(t, err)
 	clearBucket(t, l)
 	return l
 }
 
 func clearBucket(t *testing.T, l clusterLister) {
 	// 列举所有
-	ch := make(chan string, 1000)
-	go func() {
-		defer close(ch)
-		err := l.listPrefixToChannel(context.Background(), "", ch)
-		assert.NoError(t, err)
-	}()
+	keys, err := l.listPrefix(context.Background(), "")
+	assert.NoError(t, err)
 
-	errCh := make(chan DeleteKeysError, 1)
-	go func() {
-		for range errCh {
-			// ignore error
-		}
-	}()
-	var wg sync.WaitGroup
-	for i := 0; i < 20; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			// TODO
-			// err := l.deleteKeysFromChannel(ch, true, errCh)
-			// assert.NoError(t, err)
-		}()
-	}
-	wg.Wait()
+	_, err = l.deleteKeys(context.Background(), keys)
+	assert.NoError(t, err)
 }
 
 func TestSingleClusterLister_upload_listPrefixToChannel_delete(t *testing.T) {
 
-	uploader := NewUploader(getConfig1())
+	uploader, err := NewUploader(getConfig1())
+	assert.NoError(t, err)
 
 	l := getClearedSingleClusterListerForTest(t)
 
@@ -69,3 +52,168 @@ func TestSingleClusterLister_upload_listPrefixToChannel_delete(t *testing.T) {
 		assert.NoError(t, err)
 	}
 }
+
+// 按 key 调整分片上传初始化时间的 MemoryBackend
+type agedBackend struct {
+	*MemoryBackend
+	ages map[string]time.Duration
+}
+
+func (b *agedBackend) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	uploads, err := b.MemoryBackend.ListMultipartUploads(ctx, prefix)
+	for i := range uploads {
+		uploads[i].Initiated = uploads[i].Initiated.Add(-b.ages[uploads[i].Key])
+	}
+	return uploads, err
+}
+
+// 初始化分片上传并上传 size 字节的分片
+func initiateUpload(t *testing.T, b Backend, key string, size int) string {
+	ctx := context.Background()
+	uploadID, err := b.InitiateMultipartUpload(ctx, key, nil)
+	assert.NoError(t, err)
+	_, err = b.UploadPart(ctx, key, uploadID, 1, strings.NewReader(strings.Repeat("x", size)), int64(size), nil)
+	assert.NoError(t, err)
+	return uploadID
+}
+
+func TestSingleClusterLister_abortUploads(t *testing.T) {
+	ctx := context.Background()
+	backend := &agedBackend{MemoryBackend: NewMemoryBackend(), ages: map[string]time.Duration{
+		"tmp/old1": 48 * time.Hour,
+		"tmp/old2": 25 * time.Hour,
+		"other":    48 * time.Hour,
+	}}
+	l, err := newSingleClusterLister(&Config{Backend: backend, BatchSize: 1})
+	assert.NoError(t, err)
+
+	old1 := initiateUpload(t, backend, "tmp/old1", 10)
+	initiateUpload(t, backend, "tmp/old2", 20)
+	initiateUpload(t, backend, "tmp/new", 30)
+	initiateUpload(t, backend, "other", 40)
+
+	// DryRun 只统计，不取消
+	opts := AbortUploadsOptions{Prefix: "tmp/", OlderThan: 24 * time.Hour, DryRun: true}
+	result, err := l.abortUploads(ctx, opts)
+	assert.NoError(t, err)
+	if assert.Len(t, result.Uploads, 2) {
+		assert.Equal(t, "tmp/old1", result.Uploads[0].Key)
+		assert.Equal(t, old1, result.Uploads[0].UploadID)
+		assert.Equal(t, int64(10), result.Uploads[0].Size)
+		assert.Equal(t, "tmp/old2", result.Uploads[1].Key)
+		assert.NoError(t, result.Uploads[1].Err)
+	}
+	assert.Equal(t, int64(30), result.Size)
+	uploads, err := backend.ListMultipartUploads(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, uploads, 4)
+
+	opts.DryRun = false
+	result, err = l.abortUploads(ctx, opts)
+	assert.NoError(t, err)
+	assert.Len(t, result.Uploads, 2)
+	assert.Equal(t, int64(30), result.Size)
+	uploads, err = backend.ListMultipartUploads(ctx, "")
+	assert.NoError(t, err)
+	if assert.Len(t, uploads, 2) {
+		assert.Equal(t, "other", uploads[0].Key)
+		assert.Equal(t, "tmp/new", uploads[1].Key)
+	}
+
+	// OlderThan 为 0 时清理所有匹配前缀的分片上传
+	result, err = l.abortUploads(ctx, AbortUploadsOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Uploads, 2)
+	assert.Equal(t, int64(70), result.Size)
+
+	// 后端不支持列举分片上传
+	l, err = newSingleClusterLister(&Config{Backend: &multipartBackend{Backend: backend}})
+	assert.NoError(t, err)
+	_, err = l.abortUploads(ctx, AbortUploadsOptions{})
+	assert.ErrorIs(t, err, ErrNotSupported)
+}
+
+// 删除指定 key 时失败的 MemoryBackend，与 OBS 一样只返回删除失败的对象
+type failDeleteBackend struct {
+	*MemoryBackend
+	failures map[string]bool
+}
+
+func (b *failDeleteBackend) DeleteObjects(ctx context.Context, keys []string) ([]*DeleteKeysError, error) {
+	var (
+		deleted []string
+		errs    []*DeleteKeysError
+	)
+	for _, key := range keys {
+		if b.failures[key] {
+			errs = append(errs, &DeleteKeysError{Name: key, Code: "AccessDenied", Message: "Access Denied"})
+		} else {
+			deleted = append(deleted, key)
+		}
+	}
+	if _, err := b.MemoryBackend.DeleteObjects(ctx, deleted); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func TestSingleClusterLister_deleteKeysFailures(t *testing.T) {
+	backend := &failDeleteBackend{MemoryBackend: NewMemoryBackend(), failures: map[string]bool{"b": true, "e": true}}
+	l, err := newSingleClusterLister(&Config{Backend: backend, BatchSize: 2})
+	assert.NoError(t, err)
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		assert.NoError(t, backend.PutObject(context.Background(), key, strings.NewReader("0"), 1, nil))
+	}
+
+	errs, err := l.deleteKeys(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Len(t, errs, len(keys))
+	for i, key := range keys {
+		if backend.failures[key] {
+			assert.Equal(t, key, errs[i].Name)
+			assert.Equal(t, "AccessDenied", errs[i].Code)
+		} else {
+			assert.Nil(t, errs[i], key)
+		}
+	}
+	remaining, err := l.listPrefix(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "e"}, remaining)
+}
+
+// HeadObject 对指定的 key 返回错误
+type failHeadBackend struct {
+	*MemoryBackend
+	failures map[string]error
+}
+
+func (b *failHeadBackend) HeadObject(ctx context.Context, key string) (*Entry, error) {
+	if err := b.failures[key]; err != nil {
+		return nil, err
+	}
+	return b.MemoryBackend.HeadObject(ctx, key)
+}
+
+func TestSingleClusterLister_listStatErrors(t *testing.T) {
+	denied := newObsError(403, "AccessDenied", "denied")
+	backend := &failHeadBackend{MemoryBackend: NewMemoryBackend(), failures: map[string]error{"denied": denied}}
+	l, err := newSingleClusterLister(&Config{Backend: backend})
+	assert.NoError(t, err)
+	assert.NoError(t, backend.PutObject(context.Background(), "a", strings.NewReader("0"), 1, nil))
+
+	stats, err := l.listStat(context.Background(), []string{"a", "not-exist", "denied"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats[0].Size)
+	assert.Equal(t, 200, stats[0].Code)
+	assert.NoError(t, stats[0].Err)
+
+	assert.Equal(t, int64(-1), stats[1].Size)
+	assert.Equal(t, 404, stats[1].Code)
+	assert.ErrorIs(t, stats[1].Err, ErrNotFound)
+
+	// 其他错误与对象不存在区分开
+	assert.Equal(t, int64(-1), stats[2].Size)
+	assert.Equal(t, 403, stats[2].Code)
+	assert.Equal(t, denied, stats[2].Err)
+}
@@ -0,0 +1,75 @@
+package operation
+
+import (
+	"errors"
+	"time"
+)
+
+// Logger 结构化日志接口，keysAndValues 为交替出现的字段名和值，
+// 方法签名与 log/slog 的 *slog.Logger 一致，可以直接传入
+//
+// 使用的字段：op、bucket、key、bytes、duration、attempt、error
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// 默认不输出日志
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// 携带公共字段的日志
+type fieldLogger struct {
+	logger Logger
+	fields []interface{}
+}
+
+func newFieldLogger(c *Config) *fieldLogger {
+	var logger Logger = nopLogger{}
+	if c.Logger != nil {
+		logger = c.Logger
+	}
+	return &fieldLogger{logger: logger, fields: []interface{}{"bucket", c.Bucket}}
+}
+
+// 返回追加了字段的日志，原日志不变
+func (l *fieldLogger) with(keysAndValues ...interface{}) *fieldLogger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	return &fieldLogger{logger: l.logger, fields: append(fields, keysAndValues...)}
+}
+
+func (l *fieldLogger) args(keysAndValues []interface{}) []interface{} {
+	return append(l.fields[:len(l.fields):len(l.fields)], keysAndValues...)
+}
+
+func (l *fieldLogger) debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, l.args(keysAndValues)...)
+}
+
+func (l *fieldLogger) warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, l.args(keysAndValues)...)
+}
+
+func (l *fieldLogger) error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, l.args(keysAndValues)...)
+}
+
+// 记录操作结果，成功或对象不存在时为 debug 级别，其他错误为 error 级别
+func (l *fieldLogger) finish(op string, duration time.Duration, bytes int64, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		l.error(op+" failed", "bytes", bytes, "duration", duration, "error", err)
+		return
+	}
+	if err != nil {
+		l.debug(op+" failed", "bytes", bytes, "duration", duration, "error", err)
+		return
+	}
+	l.debug(op+" finished", "bytes", bytes, "duration", duration)
+}
@@ -0,0 +1,107 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type logRecord struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// 记录所有日志的 Logger
+type recordLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordLogger) log(level, msg string, keysAndValues []interface{}) {
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+	}
+	l.mu.Lock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, fields: fields})
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log("debug", msg, keysAndValues)
+}
+
+func (l *recordLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.log("info", msg, keysAndValues)
+}
+
+func (l *recordLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log("warn", msg, keysAndValues)
+}
+
+func (l *recordLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.log("error", msg, keysAndValues)
+}
+
+func TestLogger_Upload(t *testing.T) {
+	logger := &recordLogger{}
+	backend := &flakyBackend{Backend: NewMemoryBackend(), err: newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", ""), failures: 1}
+	uploader, err := NewUploader(&Config{Bucket: "bucket", Backend: backend, Logger: logger, RetryPolicy: fastRetryPolicy(2)})
+	assert.NoError(t, err)
+
+	err = uploader.UploadData([]byte("data"), "/key")
+	assert.NoError(t, err)
+	assert.Len(t, logger.records, 2)
+
+	retry := logger.records[0]
+	assert.Equal(t, "warn", retry.level)
+	assert.Equal(t, OpUploadData, retry.fields["op"])
+	assert.Equal(t, "bucket", retry.fields["bucket"])
+	assert.Equal(t, "key", retry.fields["key"])
+	assert.Equal(t, 1, retry.fields["attempt"])
+	assert.Error(t, retry.fields["error"].(error))
+
+	done := logger.records[1]
+	assert.Equal(t, "debug", done.level)
+	assert.Equal(t, "upload_data finished", done.msg)
+	assert.Equal(t, int64(4), done.fields["bytes"])
+	assert.IsType(t, time.Duration(0), done.fields["duration"])
+
+	// 上传失败时输出 error 日志
+	err = uploader.Upload("not-exist", "key")
+	assert.Error(t, err)
+	failed := logger.records[len(logger.records)-1]
+	assert.Equal(t, "error", failed.level)
+	assert.Equal(t, err, failed.fields["error"])
+}
+
+func TestLogger_Download(t *testing.T) {
+	logger := &recordLogger{}
+	backend := NewMemoryBackend()
+	assert.NoError(t, backend.PutObject(context.Background(), "key", strings.NewReader("data"), 4, nil))
+	downloader, err := NewDownloader(&Config{Bucket: "bucket", Backend: backend, Logger: logger})
+	assert.NoError(t, err)
+
+	_, err = downloader.DownloadBytes("key")
+	assert.NoError(t, err)
+	assert.Len(t, logger.records, 1)
+	assert.Equal(t, OpDownload, logger.records[0].fields["op"])
+	assert.Equal(t, int64(4), logger.records[0].fields["bytes"])
+}
+
+func TestLogger_Silent(t *testing.T) {
+	log := newFieldLogger(&Config{})
+	assert.Equal(t, nopLogger{}, log.logger)
+
+	// with 不修改原日志的字段
+	child := log.with("op", "upload")
+	assert.Len(t, log.fields, 2)
+	assert.Len(t, child.fields, 4)
+}
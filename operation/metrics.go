@@ -0,0 +1,95 @@
+package operation
+
+import (
+	"io"
+	"time"
+)
+
+// 指标和日志中的操作名
+const (
+	// OpUpload 上传文件
+	OpUpload = "upload"
+	// OpUploadData 上传内存数据
+	OpUploadData = "upload_data"
+	// OpUploadReader 流式上传长度未知的数据
+	OpUploadReader = "upload_reader"
+	// OpDownload 下载整个对象
+	OpDownload = "download"
+	// OpDownloadRange 下载对象的指定范围
+	OpDownloadRange = "download_range"
+	// OpDownloadFile 下载对象到本地文件
+	OpDownloadFile = "download_file"
+	// OpOpen 打开对象用于随机读取，之后的每次下载记为 OpDownloadRange
+	OpOpen = "open"
+	// OpDownloadBlock 块缓存下载缺少的块，包括预读
+	OpDownloadBlock = "download_block"
+	// OpListPage 列举一页对象
+	OpListPage = "list_page"
+	// OpStat 获取单个对象的元信息
+	OpStat = "stat"
+	// OpStatBucket 获取存储空间的元信息
+	OpStatBucket = "stat_bucket"
+	// OpDelete 删除单个对象
+	OpDelete = "delete"
+	// OpDeleteBatch 批量删除一批对象
+	OpDeleteBatch = "delete_batch"
+	// OpListUploads 列举未完成的分片上传
+	OpListUploads = "list_uploads"
+	// OpListParts 列举分片上传中已上传的分片
+	OpListParts = "list_parts"
+	// OpAbortUpload 取消分片上传
+	OpAbortUpload = "abort_upload"
+)
+
+// MetricsSink 指标接口，每个操作结束后调用一次 Observe，实现需要并发安全
+type MetricsSink interface {
+	// Observe 记录一次操作，err 为 nil 表示成功，bytes 为传输的字节数，没有数据传输的操作为 0，
+	// duration 包含所有重试的耗时，返回 Body 的下载包含读取 Body 的时间
+	Observe(op string, err error, bytes int64, duration time.Duration)
+}
+
+// 默认不记录指标
+type nopMetrics struct{}
+
+func (nopMetrics) Observe(string, error, int64, time.Duration) {}
+
+func newMetricsSink(c *Config) MetricsSink {
+	if c.Metrics != nil {
+		return c.Metrics
+	}
+	return nopMetrics{}
+}
+
+// 指标中的操作结果
+func resultOf(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// 统计读取的字节数，关闭时记录操作的指标
+type observedBody struct {
+	io.ReadCloser
+	observe func(bytes int64, err error)
+	bytes   int64
+	err     error
+}
+
+func (r *observedBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *observedBody) Close() error {
+	err := r.ReadCloser.Close()
+	if r.observe != nil {
+		r.observe(r.bytes, r.err)
+		r.observe = nil
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package operation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 默认的耗时分桶，单位秒
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// 默认的字节数分桶，1KiB 到 1GiB
+var defaultBytesBuckets = []float64{1 << 10, 16 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20, 256 << 20, 1 << 30}
+
+// PrometheusSink 以 Prometheus 文本格式导出指标的 MetricsSink，不依赖 Prometheus 客户端库，
+// 可以直接注册为 HTTP 处理器：
+//
+//	sink := operation.NewPrometheusSink("obs")
+//	http.Handle("/metrics", sink)
+//
+// 导出的指标（op 为操作名，result 为 success 或 error）：
+//
+//	<namespace>_operations_total{op, result}            操作次数
+//	<namespace>_operation_duration_seconds{op, result}  操作耗时
+//	<namespace>_operation_bytes{op, result}             传输的字节数
+type PrometheusSink struct {
+	namespace string
+
+	mu     sync.Mutex
+	series map[prometheusLabels]*prometheusSeries
+}
+
+type prometheusLabels struct {
+	op     string
+	result string
+}
+
+type prometheusSeries struct {
+	count    uint64
+	duration *prometheusHistogram
+	bytes    *prometheusHistogram
+}
+
+type prometheusHistogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+}
+
+// NewPrometheusSink 创建 Prometheus 指标，namespace 为指标名的前缀，为空时不加前缀
+func NewPrometheusSink(namespace string) *PrometheusSink {
+	return &PrometheusSink{namespace: namespace, series: make(map[prometheusLabels]*prometheusSeries)}
+}
+
+// Observe 记录一次操作
+func (s *PrometheusSink) Observe(op string, err error, bytes int64, duration time.Duration) {
+	labels := prometheusLabels{op: op, result: resultOf(err)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	series, ok := s.series[labels]
+	if !ok {
+		series = &prometheusSeries{
+			duration: newPrometheusHistogram(defaultDurationBuckets),
+			bytes:    newPrometheusHistogram(defaultBytesBuckets),
+		}
+		s.series[labels] = series
+	}
+	series.count++
+	series.duration.observe(duration.Seconds())
+	series.bytes.observe(float64(bytes))
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出所有指标
+func (s *PrometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.WriteTo(w)
+}
+
+// WriteTo 以 Prometheus 文本格式写出所有指标
+func (s *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	labels := make([]prometheusLabels, 0, len(s.series))
+	for l := range s.series {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].op != labels[j].op {
+			return labels[i].op < labels[j].op
+		}
+		return labels[i].result < labels[j].result
+	})
+
+	pw := &prometheusWriter{w: w}
+	name := s.name("operations_total")
+	pw.printf("# HELP %s Total number of object operations.\n# TYPE %s counter\n", name, name)
+	for _, l := range labels {
+		pw.printf("%s{%s} %d\n", name, l.format(), s.series[l].count)
+	}
+	s.writeHistogram(pw, "operation_duration_seconds", "Duration of object operations in seconds, including retries.", labels, func(series *prometheusSeries) *prometheusHistogram {
+		return series.duration
+	})
+	s.writeHistogram(pw, "operation_bytes", "Bytes transferred by object operations.", labels, func(series *prometheusSeries) *prometheusHistogram {
+		return series.bytes
+	})
+	return pw.n, pw.err
+}
+
+func (s *PrometheusSink) writeHistogram(pw *prometheusWriter, name, help string, labels []prometheusLabels, histogram func(*prometheusSeries) *prometheusHistogram) {
+	name = s.name(name)
+	pw.printf("# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, l := range labels {
+		h := histogram(s.series[l])
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += h.counts[i]
+			pw.printf("%s_bucket{%s,le=\"%s\"} %d\n", name, l.format(), formatFloat(bound), cumulative)
+		}
+		count := s.series[l].count
+		pw.printf("%s_bucket{%s,le=\"+Inf\"} %d\n", name, l.format(), count)
+		pw.printf("%s_sum{%s} %s\n", name, l.format(), formatFloat(h.sum))
+		pw.printf("%s_count{%s} %d\n", name, l.format(), count)
+	}
+}
+
+func (s *PrometheusSink) name(name string) string {
+	if s.namespace == "" {
+		return name
+	}
+	return s.namespace + "_" + name
+}
+
+func (l prometheusLabels) format() string {
+	return fmt.Sprintf("op=%s,result=%s", strconv.Quote(l.op), strconv.Quote(l.result))
+}
+
+func newPrometheusHistogram(buckets []float64) *prometheusHistogram {
+	return &prometheusHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// 记录到第一个上界不小于 v 的分桶，输出时累加
+func (h *prometheusHistogram) observe(v float64) {
+	h.sum += v
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		h.counts[i]++
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 记录写出的字节数和第一个错误
+type prometheusWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (pw *prometheusWriter) printf(format string, args ...interface{}) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, args...)
+	pw.n += int64(n)
+	pw.err = err
+}
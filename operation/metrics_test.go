@@ -0,0 +1,140 @@
+package operation
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metricsRecord struct {
+	op    string
+	err   error
+	bytes int64
+}
+
+// 记录所有操作的 MetricsSink
+type recordMetrics struct {
+	mu      sync.Mutex
+	records []metricsRecord
+}
+
+func (m *recordMetrics) Observe(op string, err error, bytes int64, duration time.Duration) {
+	m.mu.Lock()
+	m.records = append(m.records, metricsRecord{op: op, err: err, bytes: bytes})
+	m.mu.Unlock()
+}
+
+func (m *recordMetrics) last() metricsRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.records[len(m.records)-1]
+}
+
+func TestMetrics_Operations(t *testing.T) {
+	metrics := &recordMetrics{}
+	config := &Config{Backend: NewMemoryBackend(), Metrics: metrics}
+	uploader, err := NewUploader(config)
+	assert.NoError(t, err)
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	lister, err := NewLister(config)
+	assert.NoError(t, err)
+
+	assert.NoError(t, uploader.UploadData([]byte("data"), "key"))
+	assert.Equal(t, metricsRecord{op: OpUploadData, bytes: 4}, metrics.last())
+
+	_, data, err := downloader.DownloadRangeBytes("key", 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "at", string(data))
+	assert.Equal(t, metricsRecord{op: OpDownloadRange, bytes: 2}, metrics.last())
+
+	// 返回 Body 的下载在关闭后记录
+	count := len(metrics.records)
+	reader, err := downloader.DownloadRaw("key", nil)
+	assert.NoError(t, err)
+	assert.Len(t, metrics.records, count)
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, metricsRecord{op: OpDownload, bytes: 4}, metrics.last())
+
+	_, err = lister.ListPrefix("")
+	assert.NoError(t, err)
+	assert.Equal(t, OpListPage, metrics.last().op)
+
+	_, err = lister.Stat("not-exist")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, OpStat, metrics.last().op)
+	assert.ErrorIs(t, metrics.last().err, ErrNotFound)
+
+	_, err = lister.DeleteKeys([]string{"key"})
+	assert.NoError(t, err)
+	assert.Equal(t, metricsRecord{op: OpDeleteBatch}, metrics.last())
+}
+
+func TestPrometheusSink(t *testing.T) {
+	sink := NewPrometheusSink("obs")
+	sink.Observe(OpUpload, nil, 2048, 20*time.Millisecond)
+	sink.Observe(OpUpload, nil, 100, 2*time.Second)
+	sink.Observe(OpStat, ErrNotFound, 0, time.Millisecond)
+
+	var buf bytes.Buffer
+	n, err := sink.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	output := buf.String()
+	for _, line := range []string{
+		"# TYPE obs_operations_total counter",
+		`obs_operations_total{op="stat",result="error"} 1`,
+		`obs_operations_total{op="upload",result="success"} 2`,
+		"# TYPE obs_operation_duration_seconds histogram",
+		`obs_operation_duration_seconds_bucket{op="upload",result="success",le="0.025"} 1`,
+		`obs_operation_duration_seconds_bucket{op="upload",result="success",le="2.5"} 2`,
+		`obs_operation_duration_seconds_bucket{op="upload",result="success",le="+Inf"} 2`,
+		`obs_operation_duration_seconds_sum{op="upload",result="success"} 2.02`,
+		`obs_operation_duration_seconds_count{op="upload",result="success"} 2`,
+		`obs_operation_bytes_bucket{op="upload",result="success",le="1024"} 1`,
+		`obs_operation_bytes_bucket{op="upload",result="success",le="16384"} 2`,
+		`obs_operation_bytes_sum{op="upload",result="success"} 2148`,
+	} {
+		assert.Contains(t, output, line+"\n")
+	}
+	// 按操作名排序输出
+	assert.Less(t, strings.Index(output, `op="stat"`), strings.Index(output, `op="upload"`))
+}
+
+func TestObservedBody_ReadError(t *testing.T) {
+	var (
+		observedBytes int64
+		observedErr   error
+		calls         int
+	)
+	body := &observedBody{
+		ReadCloser: io.NopCloser(io.MultiReader(strings.NewReader("abc"), &errReader{err: io.ErrUnexpectedEOF})),
+		observe: func(bytes int64, err error) {
+			calls++
+			observedBytes, observedErr = bytes, err
+		},
+	}
+	_, err := io.ReadAll(body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NoError(t, body.Close())
+	assert.NoError(t, body.Close())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(3), observedBytes)
+	assert.ErrorIs(t, observedErr, io.ErrUnexpectedEOF)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -7,8 +7,12 @@ import (
 // FileStat 文件元信息
 type FileStat struct {
 	Name string
+	// Size 对象大小，获取失败时为 -1
 	Size int64
-	code int
+	// Code 获取元信息的 HTTP 状态码，成功为 200，对象不存在为 404，网络错误等没有状态码时为 0
+	Code int
+	// Err 获取失败的原因，对象不存在时 errors.Is(Err, ErrNotFound) 为 true，成功时为 nil
+	Err error
 }
 
 // Config 配置文件
@@ -21,6 +25,72 @@ type Config struct {
 	UpConcurrency    int
 	BatchConcurrency int
 	BatchSize        int
+	// Type 存储后端类型，可选 obs（默认）、s3、local
+	Type string
+	// LocalRoot local 后端的根目录，Bucket 对应其下的子目录
+	LocalRoot string
+	// Region s3 后端的区域，用于 V4 签名，默认 us-east-1
+	Region string
+	// Backend 自定义存储后端，设置后忽略 Type
+	Backend Backend
+	// Replicas 按顺序排列的只读副本，下载遇到可重试的错误时切换到下一个副本
+	Replicas []*Config
+	// FailoverCooldown 副本出错后被跳过的时长，默认 30 秒
+	FailoverCooldown time.Duration
+	// RetryPolicy 重试策略，为空时使用默认策略
+	RetryPolicy *RetryPolicy
+	// Logger 日志，为空时不输出日志
+	Logger Logger
+	// Metrics 指标，为空时不记录指标
+	Metrics MetricsSink
+	// Tracer 链路追踪，为空时不追踪
+	Tracer Tracer
+	// MultipartThreshold 超过该大小（MB）的文件使用分片上传，默认 50
+	MultipartThreshold int64
+	// CheckpointStore 分片上传的断点存储，设置后上传失败时保留已上传的分片，
+	// 再次上传同一文件时续传；为空时上传失败即取消分片上传
+	CheckpointStore CheckpointStore
+	// DownConcurrency 下载文件时并发下载的分段数，默认 20，分段大小为 PartSize
+	DownConcurrency int
+	// Checksum 上传时计算整个对象的校验值并保存在元数据中，下载时校验，
+	// 可选 ChecksumMD5、ChecksumSHA256、ChecksumCRC64，为空时不校验。
+	// 设置后上传的每个请求都带上 Content-MD5
+	Checksum string
+	// BlockCache 范围读取的块缓存，设置后 DownloadRangeBytes 和 ObjectReader.ReadAt 按块读取并缓存，
+	// 为空时每次读取都单独下载
+	BlockCache *BlockCacheConfig
+	// Replication 多写配置，设置后 Uploader 将每个对象同时写入本配置和 Replication.Targets 中的目标
+	Replication *ReplicationConfig
+	// ProxyURL obs、s3 后端使用的 HTTP 代理地址，为空时不使用代理
+	ProxyURL string
+	// SSLVerify obs、s3 后端是否校验服务端证书，默认不校验，与 OBS SDK 默认相同
+	SSLVerify bool
+	// PemCerts 校验服务端证书时信任的 CA 证书（PEM 格式），为空时使用系统证书
+	PemCerts []byte
+	// CheckpointBesideFile 为 true 且未设置 CheckpointStore 时，断点保存在源文件旁的 <file>.uploadfile_record 中，
+	// 与 obs.UploadFile 开启 EnableCheckpoint 时相同
+	CheckpointBesideFile bool
+}
+
+// 多集群路由方式
+const (
+	RoutingPrefix = "prefix"
+	RoutingHash   = "hash"
+)
+
+// MultiClustersConfig 多集群配置
+type MultiClustersConfig struct {
+	// Clusters 各集群的配置
+	Clusters []*ClusterConfig
+	// Routing 路由方式，可选 prefix（默认，按最长前缀匹配）、hash（按 key 的哈希值分布到所有集群）
+	Routing string
+}
+
+// ClusterConfig 单个集群的配置
+type ClusterConfig struct {
+	*Config
+	// Prefixes 路由到该集群的 key 前缀，仅用于 prefix 路由，空字符串可作为默认集群
+	Prefixes []string
 }
 
 type ListItem struct {
@@ -48,6 +118,8 @@ type Entry struct {
 	PutTime  time.Time
 	MimeType string
 	EndUser  string
+	// Metadata 自定义元数据，名称为小写
+	Metadata map[string]string
 }
 
 type BatchStatItemRet struct {
@@ -55,3 +127,30 @@ type BatchStatItemRet struct {
 	Error string
 	Code  int
 }
+
+// AbortUploadsOptions 清理未完成的分片上传的条件
+type AbortUploadsOptions struct {
+	// Prefix 只清理以 Prefix 开头的对象上的分片上传
+	Prefix string
+	// OlderThan 只清理初始化时间早于 OlderThan 之前的分片上传，为 0 时清理所有匹配前缀的分片上传
+	OlderThan time.Duration
+	// DryRun 只返回将被清理的分片上传和已上传的字节数，不取消分片上传
+	DryRun bool
+}
+
+// AbortedUpload 已清理（DryRun 时为将被清理）的分片上传
+type AbortedUpload struct {
+	MultipartUpload
+	// Size 已上传分片的总字节数
+	Size int64
+	// Err 列举分片或取消分片上传失败的原因，成功时为 nil
+	Err error
+}
+
+// AbortUploadsResult 清理未完成的分片上传的结果
+type AbortUploadsResult struct {
+	// Uploads 按 Key 和初始化时间排序
+	Uploads []*AbortedUpload
+	// Size 所有分片上传已上传分片的总字节数
+	Size int64
+}
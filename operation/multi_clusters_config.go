@@ -0,0 +1,79 @@
+package operation
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// 检查集群和路由方式是否配置正确
+func (c *MultiClustersConfig) validate() error {
+	if len(c.Clusters) == 0 {
+		return fmt.Errorf("no cluster configured")
+	}
+	switch c.Routing {
+	case "", RoutingPrefix, RoutingHash:
+		return nil
+	default:
+		return fmt.Errorf("unknown routing %q", c.Routing)
+	}
+}
+
+// 根据路由规则返回 key 所在集群的下标
+func (c *MultiClustersConfig) forKey(key string) (int, error) {
+	key = strings.TrimPrefix(key, "/")
+	if len(c.Clusters) == 0 {
+		return -1, fmt.Errorf("no cluster configured")
+	}
+
+	switch c.Routing {
+	case "", RoutingPrefix:
+		index, matched := -1, -1
+		for i, cluster := range c.Clusters {
+			for _, prefix := range cluster.Prefixes {
+				if len(prefix) > matched && strings.HasPrefix(key, prefix) {
+					index, matched = i, len(prefix)
+				}
+			}
+		}
+		if index < 0 {
+			return -1, fmt.Errorf("no cluster matches key %q", key)
+		}
+		return index, nil
+	case RoutingHash:
+		return int(crc32.ChecksumIEEE([]byte(key)) % uint32(len(c.Clusters))), nil
+	default:
+		return -1, fmt.Errorf("unknown routing %q", c.Routing)
+	}
+}
+
+// 返回可能存放以 prefix 开头的 key 的集群下标
+func (c *MultiClustersConfig) forPrefix(prefix string) []int {
+	var indexes []int
+	for i, cluster := range c.Clusters {
+		if c.Routing == RoutingHash {
+			indexes = append(indexes, i)
+			continue
+		}
+		for _, p := range cluster.Prefixes {
+			if strings.HasPrefix(p, prefix) || strings.HasPrefix(prefix, p) {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes
+}
+
+// 按集群对 key 分组，返回每个集群的 key 在原列表中的下标
+func (c *MultiClustersConfig) groupKeys(keys []string) (map[int][]int, error) {
+	groups := make(map[int][]int)
+	for i, key := range keys {
+		index, err := c.forKey(key)
+		if err != nil {
+			return nil, err
+		}
+		groups[index] = append(groups[index], i)
+	}
+	return groups, nil
+}
@@ -0,0 +1,50 @@
+package operation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiClustersConfig_ForKey(t *testing.T) {
+	config := &MultiClustersConfig{
+		Clusters: []*ClusterConfig{
+			{Config: &Config{Bucket: "default"}, Prefixes: []string{""}},
+			{Config: &Config{Bucket: "a"}, Prefixes: []string{"a/"}},
+			{Config: &Config{Bucket: "ab"}, Prefixes: []string{"a/b/", "c/"}},
+		},
+	}
+
+	for key, expected := range map[string]int{
+		"x":     0,
+		"a/1":   1,
+		"/a/1":  1,
+		"a/b/1": 2,
+		"c/1":   2,
+	} {
+		index, err := config.forKey(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, index, key)
+	}
+
+	assert.Equal(t, []int{0, 1, 2}, config.forPrefix("a"))
+	assert.Equal(t, []int{0, 2}, config.forPrefix("c/"))
+
+	config.Clusters = config.Clusters[1:]
+	_, err := config.forKey("x")
+	assert.Error(t, err)
+
+	config.Routing = RoutingHash
+	for _, key := range []string{"x", "a/1", "c/1"} {
+		index, err := config.forKey(key)
+		assert.NoError(t, err)
+		again, _ := config.forKey(key)
+		assert.Equal(t, index, again)
+		assert.True(t, index >= 0 && index < 2)
+	}
+	assert.Equal(t, []int{0, 1}, config.forPrefix("a"))
+
+	config.Routing = "unknown"
+	_, err = config.forKey("x")
+	assert.Error(t, err)
+}
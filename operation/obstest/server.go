@@ -0,0 +1,855 @@
+// Package obstest 提供一个本地的 OBS 兼容 HTTP 服务，用于在没有网络和真实存储空间的情况下测试 OBS SDK 的调用
+package obstest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AccessKey 默认的 AccessKey
+	AccessKey = "obstest-access-key"
+	// SecretKey 默认的 SecretKey
+	SecretKey = "obstest-secret-key"
+)
+
+// Server 本地 OBS 兼容服务
+// 支持 PutObject、GetObject（含 Range）、HeadObject、DeleteObject、ListObjects、DeleteObjects
+// 以及分片上传（含 ListParts、ListMultipartUploads），
+// 请求使用 V2 或 V4 签名校验，错误以 OBS 的 XML 格式返回
+type Server struct {
+	*httptest.Server
+
+	// AccessKey 与 SecretKey 用于校验请求签名
+	AccessKey string
+	SecretKey string
+	// OmitNextMarker 列举时没有 delimiter 就不返回 NextMarker，模拟 MinIO、Ceph RGW 等 S3 兼容服务
+	OmitNextMarker bool
+
+	mu           sync.Mutex
+	buckets      map[string]map[string]*object
+	uploads      map[string]*upload
+	faults       []*fault
+	nextUploadID int
+	nextReqID    int
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	contentType  string
+	lastModified time.Time
+	metadata     map[string]string
+}
+
+type upload struct {
+	bucket    string
+	key       string
+	initiated time.Time
+	metadata  map[string]string
+	parts     map[int][]byte
+}
+
+type fault struct {
+	method     string
+	remaining  int
+	statusCode int
+	code       string
+}
+
+// NewServer 启动本地 OBS 兼容服务，并创建给定的存储空间
+// 使用完毕后需要调用 Close 关闭
+func NewServer(buckets ...string) *Server {
+	s := &Server{
+		AccessKey: AccessKey,
+		SecretKey: SecretKey,
+		buckets:   make(map[string]map[string]*object),
+		uploads:   make(map[string]*upload),
+	}
+	for _, bucket := range buckets {
+		s.CreateBucket(bucket)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// CreateBucket 创建存储空间
+func (s *Server) CreateBucket(bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = make(map[string]*object)
+	}
+}
+
+// FailRequests 使接下来 n 个指定方法的请求返回给定的状态码和错误码，method 为空时匹配所有方法
+func (s *Server) FailRequests(method string, n int, statusCode int, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &fault{method: method, remaining: n, statusCode: statusCode, code: code})
+}
+
+// Object 返回对象内容，对象不存在时返回 false
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return obj.data, true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.nextReqID++
+	requestID := fmt.Sprintf("obstest%016d", s.nextReqID)
+	s.mu.Unlock()
+	w.Header().Set("x-amz-request-id", requestID)
+
+	if f := s.takeFault(r.Method); f != nil {
+		writeError(w, r, f.statusCode, f.code, "injected fault", requestID)
+		return
+	}
+
+	if err := s.verifySignature(r); err != nil {
+		writeError(w, r, http.StatusForbidden, "SignatureDoesNotMatch", err.Error(), requestID)
+		return
+	}
+
+	bucket, key := splitPath(r.URL.Path)
+	if bucket == "" {
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "bucket is required", requestID)
+		return
+	}
+
+	s.mu.Lock()
+	_, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.", requestID)
+		return
+	}
+
+	query := r.URL.Query()
+	var err *apiError
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case key == "" && r.Method == http.MethodGet && hasParam(query, "uploads"):
+		err = s.listMultipartUploads(w, bucket, query)
+	case key == "" && r.Method == http.MethodGet:
+		err = s.listObjects(w, bucket, query)
+	case key == "" && r.Method == http.MethodPost && hasParam(query, "delete"):
+		err = s.deleteObjects(w, r, bucket)
+	case key == "":
+		err = &apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	case r.Method == http.MethodPost && hasParam(query, "uploads"):
+		err = s.initiateMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && hasParam(query, "uploadId"):
+		err = s.uploadPart(w, r, bucket, key, query)
+	case r.Method == http.MethodPost && hasParam(query, "uploadId"):
+		err = s.completeMultipartUpload(w, r, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodGet && hasParam(query, "uploadId"):
+		err = s.listParts(w, bucket, key, query)
+	case r.Method == http.MethodDelete && hasParam(query, "uploadId"):
+		err = s.abortMultipartUpload(w, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut:
+		err = s.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		err = s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.buckets[bucket], key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		err = &apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	}
+	if err != nil {
+		writeError(w, r, err.statusCode, err.code, err.message, requestID)
+	}
+}
+
+func (s *Server) takeFault(method string) *fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if f.method != "" && f.method != method {
+			continue
+		}
+		f.remaining--
+		if f.remaining <= 0 {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) *apiError {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return &apiError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	}
+	if apiErr := checkContentMD5(r, data); apiErr != nil {
+		return apiErr
+	}
+
+	obj := &object{
+		data:         data,
+		etag:         quotedMD5(data),
+		contentType:  r.Header.Get("Content-Type"),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		metadata:     requestMetadata(r),
+	}
+	s.mu.Lock()
+	s.buckets[bucket][key] = obj
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) *apiError {
+	s.mu.Lock()
+	obj, ok := s.buckets[bucket][key]
+	s.mu.Unlock()
+	if !ok {
+		return &apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != obj.etag {
+		return &apiError{http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold."}
+	}
+
+	header := w.Header()
+	header.Set("ETag", obj.etag)
+	header.Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	if obj.contentType != "" {
+		header.Set("Content-Type", obj.contentType)
+	} else {
+		header.Set("Content-Type", "binary/octet-stream")
+	}
+	for name, value := range obj.metadata {
+		header.Set("x-amz-meta-"+name, value)
+	}
+
+	size := int64(len(obj.data))
+	data := obj.data
+	statusCode := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		start, end, ok := parseRange(rng, size)
+		if !ok {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return &apiError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range cannot be satisfied."}
+		}
+		data = data[start:end]
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+		statusCode = http.StatusPartialContent
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(statusCode)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	Marker         string         `xml:"Marker"`
+	NextMarker     string         `xml:"NextMarker,omitempty"`
+	MaxKeys        int            `xml:"MaxKeys"`
+	Delimiter      string         `xml:"Delimiter,omitempty"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	EncodingType   string         `xml:"EncodingType,omitempty"`
+	Contents       []listContent  `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	Owner        struct {
+		ID string `xml:"ID"`
+	} `xml:"Owner"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, bucket string, query url.Values) *apiError {
+	prefix := query.Get("prefix")
+	marker := query.Get("marker")
+	delimiter := query.Get("delimiter")
+	maxKeys := 1000
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return &apiError{http.StatusBadRequest, "InvalidArgument", "Invalid max-keys"}
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+
+	s.mu.Lock()
+	objects := s.buckets[bucket]
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := listBucketResult{
+		Name:         bucket,
+		Prefix:       encode(prefix),
+		Marker:       encode(marker),
+		MaxKeys:      maxKeys,
+		Delimiter:    encode(delimiter),
+		EncodingType: query.Get("encoding-type"),
+	}
+	var last, lastPrefix string
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				p := key[:len(prefix)+i+len(delimiter)]
+				if p == lastPrefix {
+					continue
+				}
+				if len(result.Contents)+len(result.CommonPrefixes) >= maxKeys {
+					result.IsTruncated = true
+					break
+				}
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(p)})
+				lastPrefix = p
+				last = key
+				continue
+			}
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		obj := objects[key]
+		content := listContent{
+			Key:          encode(key),
+			LastModified: obj.lastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         obj.etag,
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		}
+		content.Owner.ID = s.AccessKey
+		result.Contents = append(result.Contents, content)
+		last = key
+	}
+	s.mu.Unlock()
+
+	if result.IsTruncated && !(s.OmitNextMarker && delimiter == "") {
+		result.NextMarker = encode(last)
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool     `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Deleted []struct {
+		Key string `xml:"Key"`
+	} `xml:"Deleted"`
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) *apiError {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return &apiError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	}
+	if apiErr := checkContentMD5(r, data); apiErr != nil {
+		return apiErr
+	}
+
+	var req deleteRequest
+	if err = xml.Unmarshal(data, &req); err != nil {
+		return &apiError{http.StatusBadRequest, "MalformedXML", err.Error()}
+	}
+	if len(req.Objects) > 1000 {
+		return &apiError{http.StatusBadRequest, "MalformedXML", "too many objects to delete"}
+	}
+
+	var result deleteResult
+	s.mu.Lock()
+	for _, obj := range req.Objects {
+		delete(s.buckets[bucket], obj.Key)
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, struct {
+				Key string `xml:"Key"`
+			}{Key: obj.Key})
+		}
+	}
+	s.mu.Unlock()
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (s *Server) initiateMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) *apiError {
+	s.mu.Lock()
+	s.nextUploadID++
+	uploadID := fmt.Sprintf("obstest-upload-%d", s.nextUploadID)
+	s.uploads[uploadID] = &upload{
+		bucket:    bucket,
+		key:       key,
+		initiated: time.Now().UTC(),
+		metadata:  requestMetadata(r),
+		parts:     make(map[int][]byte),
+	}
+	s.mu.Unlock()
+
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadID: uploadID})
+	return nil
+}
+
+func (s *Server) getUpload(bucket, key, uploadID string) (*upload, *apiError) {
+	u, ok := s.uploads[uploadID]
+	if !ok || u.bucket != bucket || u.key != key {
+		return nil, &apiError{http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist."}
+	}
+	return u, nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key string, query url.Values) *apiError {
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		return &apiError{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000."}
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return &apiError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	}
+	if apiErr := checkContentMD5(r, data); apiErr != nil {
+		return apiErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, apiErr := s.getUpload(bucket, key, query.Get("uploadId"))
+	if apiErr != nil {
+		return apiErr
+	}
+	u.parts[partNumber] = data
+	w.Header().Set("ETag", quotedMD5(data))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) *apiError {
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &apiError{http.StatusBadRequest, "MalformedXML", err.Error()}
+	}
+	if len(req.Parts) == 0 {
+		return &apiError{http.StatusBadRequest, "MalformedXML", "no parts specified"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, apiErr := s.getUpload(bucket, key, uploadID)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	var (
+		data bytes.Buffer
+		sums []byte
+	)
+	for i, part := range req.Parts {
+		if i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber {
+			return &apiError{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."}
+		}
+		partData, ok := u.parts[part.PartNumber]
+		if !ok || strings.Trim(part.ETag, `"`) != strings.Trim(quotedMD5(partData), `"`) {
+			return &apiError{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+		}
+		sum := md5.Sum(partData)
+		sums = append(sums, sum[:]...)
+		data.Write(partData)
+	}
+	sum := md5.Sum(sums)
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(req.Parts))
+	s.buckets[bucket][key] = &object{
+		data:         data.Bytes(),
+		etag:         etag,
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		metadata:     u.metadata,
+	}
+	delete(s.uploads, uploadID)
+
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Location: fmt.Sprintf("%s/%s/%s", s.URL, bucket, key),
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+	return nil
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, bucket, key, uploadID string) *apiError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, apiErr := s.getUpload(bucket, key, uploadID); apiErr != nil {
+		return apiErr
+	}
+	delete(s.uploads, uploadID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type listPartsResult struct {
+	XMLName              xml.Name   `xml:"ListPartsResult"`
+	Bucket               string     `xml:"Bucket"`
+	Key                  string     `xml:"Key"`
+	UploadID             string     `xml:"UploadId"`
+	PartNumberMarker     int        `xml:"PartNumberMarker"`
+	NextPartNumberMarker int        `xml:"NextPartNumberMarker"`
+	MaxParts             int        `xml:"MaxParts"`
+	IsTruncated          bool       `xml:"IsTruncated"`
+	Parts                []listPart `xml:"Part"`
+}
+
+type listPart struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+func (s *Server) listParts(w http.ResponseWriter, bucket, key string, query url.Values) *apiError {
+	maxParts := 1000
+	if v := query.Get("max-parts"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return &apiError{http.StatusBadRequest, "InvalidArgument", "Invalid max-parts"}
+		}
+		if n < maxParts {
+			maxParts = n
+		}
+	}
+	marker, _ := strconv.Atoi(query.Get("part-number-marker"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, apiErr := s.getUpload(bucket, key, query.Get("uploadId"))
+	if apiErr != nil {
+		return apiErr
+	}
+	numbers := make([]int, 0, len(u.parts))
+	for partNumber := range u.parts {
+		if partNumber > marker {
+			numbers = append(numbers, partNumber)
+		}
+	}
+	sort.Ints(numbers)
+
+	result := listPartsResult{
+		Bucket:           bucket,
+		Key:              key,
+		UploadID:         query.Get("uploadId"),
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+	}
+	for _, partNumber := range numbers {
+		if len(result.Parts) >= maxParts {
+			result.IsTruncated = true
+			result.NextPartNumberMarker = result.Parts[len(result.Parts)-1].PartNumber
+			break
+		}
+		data := u.parts[partNumber]
+		result.Parts = append(result.Parts, listPart{
+			PartNumber:   partNumber,
+			LastModified: u.initiated.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         quotedMD5(data),
+			Size:         int64(len(data)),
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+type listMultipartUploadsResult struct {
+	XMLName            xml.Name     `xml:"ListMultipartUploadsResult"`
+	Bucket             string       `xml:"Bucket"`
+	KeyMarker          string       `xml:"KeyMarker"`
+	UploadIDMarker     string       `xml:"UploadIdMarker"`
+	NextKeyMarker      string       `xml:"NextKeyMarker"`
+	NextUploadIDMarker string       `xml:"NextUploadIdMarker"`
+	MaxUploads         int          `xml:"MaxUploads"`
+	IsTruncated        bool         `xml:"IsTruncated"`
+	Prefix             string       `xml:"Prefix"`
+	EncodingType       string       `xml:"EncodingType,omitempty"`
+	Uploads            []listUpload `xml:"Upload"`
+}
+
+type listUpload struct {
+	Key          string `xml:"Key"`
+	UploadID     string `xml:"UploadId"`
+	Initiated    string `xml:"Initiated"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// 按 key 和 uploadID 排序列举，不支持 delimiter
+func (s *Server) listMultipartUploads(w http.ResponseWriter, bucket string, query url.Values) *apiError {
+	prefix := query.Get("prefix")
+	keyMarker := query.Get("key-marker")
+	uploadIDMarker := query.Get("upload-id-marker")
+	maxUploads := 1000
+	if v := query.Get("max-uploads"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return &apiError{http.StatusBadRequest, "InvalidArgument", "Invalid max-uploads"}
+		}
+		if n < maxUploads {
+			maxUploads = n
+		}
+	}
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+
+	type entry struct {
+		uploadID string
+		*upload
+	}
+	s.mu.Lock()
+	var entries []entry
+	for uploadID, u := range s.uploads {
+		if u.bucket != bucket || !strings.HasPrefix(u.key, prefix) {
+			continue
+		}
+		if u.key < keyMarker || (u.key == keyMarker && uploadID <= uploadIDMarker) {
+			continue
+		}
+		entries = append(entries, entry{uploadID, u})
+	}
+	s.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].key != entries[j].key {
+			return entries[i].key < entries[j].key
+		}
+		return entries[i].uploadID < entries[j].uploadID
+	})
+
+	result := listMultipartUploadsResult{
+		Bucket:         bucket,
+		KeyMarker:      encode(keyMarker),
+		UploadIDMarker: uploadIDMarker,
+		MaxUploads:     maxUploads,
+		Prefix:         encode(prefix),
+		EncodingType:   query.Get("encoding-type"),
+	}
+	for i, e := range entries {
+		if i >= maxUploads {
+			last := entries[i-1]
+			result.IsTruncated = true
+			result.NextKeyMarker = encode(last.key)
+			result.NextUploadIDMarker = last.uploadID
+			break
+		}
+		result.Uploads = append(result.Uploads, listUpload{
+			Key:          encode(e.key),
+			UploadID:     e.uploadID,
+			Initiated:    e.initiated.Format("2006-01-02T15:04:05.000Z"),
+			StorageClass: "STANDARD",
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+type apiError struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+	HostID    string   `xml:"HostId"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, statusCode int, code, message, requestID string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(statusCode)
+		return
+	}
+	writeXML(w, statusCode, errorResponse{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+		HostID:    "obstest",
+	})
+}
+
+func writeXML(w http.ResponseWriter, statusCode int, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(data)))
+	w.WriteHeader(statusCode)
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+}
+
+// 请求中 x-amz-meta- 开头的自定义元数据，名称转换为小写
+func requestMetadata(r *http.Request) map[string]string {
+	metadata := make(map[string]string)
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-meta-") {
+			metadata[name[len("x-amz-meta-"):]] = values[0]
+		}
+	}
+	return metadata
+}
+
+func checkContentMD5(r *http.Request, data []byte) *apiError {
+	expected := r.Header.Get("Content-MD5")
+	if expected == "" {
+		return nil
+	}
+	if expected != base64MD5(data) {
+		return &apiError{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received."}
+	}
+	return nil
+}
+
+// 将 /bucket/key 形式的路径拆分为存储空间和对象名
+func splitPath(path string) (bucket, key string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func hasParam(query url.Values, name string) bool {
+	_, ok := query[name]
+	return ok
+}
+
+// 解析 Range 请求头，返回数据中的起止位置 [start, end)
+func parseRange(header string, size int64) (start, end int64, ok bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	if spec == header || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, false
+	}
+	first, last := spec[:i], spec[i+1:]
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, size > 0
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < start {
+			return 0, 0, false
+		}
+		if n+1 < end {
+			end = n + 1
+		}
+	}
+	return start, end, true
+}
+
+func quotedMD5(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,235 @@
+package obstest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, s *Server, sk string) *obs.ObsClient {
+	client, err := obs.New(s.AccessKey, sk, s.URL, obs.WithMaxRetryCount(0))
+	assert.NoError(t, err)
+	return client
+}
+
+func putObject(t *testing.T, client *obs.ObsClient, bucket, key string, data []byte) {
+	input := &obs.PutObjectInput{}
+	input.Bucket = bucket
+	input.Key = key
+	input.Body = bytes.NewReader(data)
+	_, err := client.PutObject(input)
+	assert.NoError(t, err)
+}
+
+func TestServer_PutGetHeadObject(t *testing.T) {
+	s := NewServer("bucket")
+	defer s.Close()
+	client := newTestClient(t, s, s.SecretKey)
+
+	key := "dir/中文 key+1"
+	putObject(t, client, "bucket", key, []byte("0123456789"))
+	data, ok := s.Object("bucket", key)
+	assert.True(t, ok)
+	assert.Equal(t, "0123456789", string(data))
+
+	// 范围下载
+	input := &obs.GetObjectInput{}
+	input.Bucket = "bucket"
+	input.Key = key
+	output, err := client.GetObject(input, obs.WithCustomHeader("Range", "bytes=2-5"))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(output.Body)
+	output.Body.Close()
+	assert.Equal(t, http.StatusPartialContent, output.StatusCode)
+	assert.Equal(t, "2345", string(body))
+	assert.Equal(t, []string{"bytes 2-5/10"}, output.ResponseHeaders["content-range"])
+
+	// 元信息
+	metaInput := &obs.GetObjectMetadataInput{}
+	metaInput.Bucket = "bucket"
+	metaInput.Key = key
+	meta, err := client.GetObjectMetadata(metaInput)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), meta.ContentLength)
+	assert.Equal(t, `"781e5e245d69b566979b86e28d23f2c7"`, meta.ETag)
+	assert.False(t, meta.LastModified.IsZero())
+
+	// 不存在的对象
+	input.Key = "not-exist"
+	_, err = client.GetObject(input)
+	obsErr, ok := err.(obs.ObsError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, obsErr.StatusCode)
+	assert.Equal(t, "NoSuchKey", obsErr.Code)
+	assert.NotEmpty(t, obsErr.RequestId)
+}
+
+func TestServer_ListObjects(t *testing.T) {
+	s := NewServer("bucket")
+	defer s.Close()
+	client := newTestClient(t, s, s.SecretKey)
+
+	keys := []string{"a/1", "a/2", "a/b/3", "a/空 格", "b"}
+	for _, key := range keys {
+		putObject(t, client, "bucket", key, nil)
+	}
+
+	var (
+		listed []string
+		marker string
+	)
+	for {
+		input := &obs.ListObjectsInput{}
+		input.Bucket = "bucket"
+		input.Prefix = "a/"
+		input.Marker = marker
+		input.MaxKeys = 2
+		input.EncodingType = "url"
+		output, err := client.ListObjects(input)
+		assert.NoError(t, err)
+		for _, content := range output.Contents {
+			listed = append(listed, content.Key)
+		}
+		if output.NextMarker == "" {
+			break
+		}
+		marker = output.NextMarker
+	}
+	assert.Equal(t, []string{"a/1", "a/2", "a/b/3", "a/空 格"}, listed)
+
+	input := &obs.ListObjectsInput{}
+	input.Bucket = "bucket"
+	input.Prefix = "a/"
+	input.Delimiter = "/"
+	input.EncodingType = "url"
+	output, err := client.ListObjects(input)
+	assert.NoError(t, err)
+	assert.Len(t, output.Contents, 3)
+	assert.Equal(t, []string{"a/b/"}, output.CommonPrefixes)
+}
+
+func TestServer_DeleteObjects(t *testing.T) {
+	s := NewServer("bucket")
+	defer s.Close()
+	client := newTestClient(t, s, s.SecretKey)
+
+	putObject(t, client, "bucket", "a", nil)
+	putObject(t, client, "bucket", "b", nil)
+
+	input := &obs.DeleteObjectsInput{}
+	input.Bucket = "bucket"
+	input.Objects = []obs.ObjectToDelete{{Key: "a"}, {Key: "b"}}
+	output, err := client.DeleteObjects(input)
+	assert.NoError(t, err)
+	assert.Len(t, output.Deleteds, 2)
+
+	_, ok := s.Object("bucket", "a")
+	assert.False(t, ok)
+}
+
+func TestServer_MultipartUpload(t *testing.T) {
+	s := NewServer("bucket")
+	defer s.Close()
+	client := newTestClient(t, s, s.SecretKey)
+
+	initInput := &obs.InitiateMultipartUploadInput{}
+	initInput.Bucket = "bucket"
+	initInput.Key = "multipart"
+	initOutput, err := client.InitiateMultipartUpload(initInput)
+	assert.NoError(t, err)
+
+	var parts []obs.Part
+	for i, data := range []string{"hello ", "world"} {
+		partOutput, err := client.UploadPart(&obs.UploadPartInput{
+			Bucket:     "bucket",
+			Key:        "multipart",
+			UploadId:   initOutput.UploadId,
+			PartNumber: i + 1,
+			Body:       strings.NewReader(data),
+		})
+		assert.NoError(t, err)
+		parts = append(parts, obs.Part{PartNumber: i + 1, ETag: partOutput.ETag})
+	}
+
+	_, err = client.CompleteMultipartUpload(&obs.CompleteMultipartUploadInput{
+		Bucket:   "bucket",
+		Key:      "multipart",
+		UploadId: initOutput.UploadId,
+		Parts:    parts,
+	})
+	assert.NoError(t, err)
+
+	data, ok := s.Object("bucket", "multipart")
+	assert.True(t, ok)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestServer_SignatureAndFaults(t *testing.T) {
+	s := NewServer("bucket")
+	defer s.Close()
+
+	// 错误的 SecretKey
+	input := &obs.PutObjectInput{}
+	input.Bucket = "bucket"
+	input.Key = "key"
+	input.Body = strings.NewReader("data")
+	_, err := newTestClient(t, s, "wrong-secret-key").PutObject(input)
+	obsErr, ok := err.(obs.ObsError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, obsErr.StatusCode)
+	assert.Equal(t, "SignatureDoesNotMatch", obsErr.Code)
+
+	// 注入故障
+	client := newTestClient(t, s, s.SecretKey)
+	s.FailRequests(http.MethodPut, 1, http.StatusServiceUnavailable, "ServiceUnavailable")
+	input.Body = strings.NewReader("data")
+	_, err = client.PutObject(input)
+	obsErr, ok = err.(obs.ObsError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusServiceUnavailable, obsErr.StatusCode)
+
+	input.Body = strings.NewReader("data")
+	_, err = client.PutObject(input)
+	assert.NoError(t, err)
+}
+
+func TestServer_SignatureV4(t *testing.T) {
+	s := NewServer("bucket")
+	defer s.Close()
+
+	newV4Client := func(sk string) *obs.ObsClient {
+		client, err := obs.New(s.AccessKey, sk, s.URL, obs.WithMaxRetryCount(0),
+			obs.WithSignature(obs.SignatureV4), obs.WithPathStyle(true), obs.WithRegion("us-east-1"))
+		assert.NoError(t, err)
+		return client
+	}
+
+	client := newV4Client(s.SecretKey)
+	putObject(t, client, "bucket", "dir/中文 key+1", []byte("data"))
+	data, ok := s.Object("bucket", "dir/中文 key+1")
+	assert.True(t, ok)
+	assert.Equal(t, "data", string(data))
+
+	input := &obs.ListObjectsInput{}
+	input.Bucket = "bucket"
+	input.Prefix = "dir/"
+	input.EncodingType = "url"
+	output, err := client.ListObjects(input)
+	assert.NoError(t, err)
+	assert.Len(t, output.Contents, 1)
+
+	putInput := &obs.PutObjectInput{}
+	putInput.Bucket = "bucket"
+	putInput.Key = "key"
+	putInput.Body = strings.NewReader("data")
+	_, err = newV4Client("wrong-secret-key").PutObject(putInput)
+	obsErr, ok := err.(obs.ObsError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, obsErr.StatusCode)
+	assert.Equal(t, "SignatureDoesNotMatch", obsErr.Code)
+}
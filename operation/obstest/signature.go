@@ -0,0 +1,254 @@
+package obstest
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 参与签名的子资源，与 OBS SDK 保持一致
+var subResources = map[string]bool{
+	"acl":                          true,
+	"delete":                       true,
+	"lifecycle":                    true,
+	"location":                     true,
+	"logging":                      true,
+	"metadata":                     true,
+	"partnumber":                   true,
+	"policy":                       true,
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+	"storageinfo":                  true,
+	"tagging":                      true,
+	"uploadid":                     true,
+	"uploads":                      true,
+	"versionid":                    true,
+	"versioning":                   true,
+	"versions":                     true,
+}
+
+// 校验请求签名，支持 V2 和 V4 两种签名方式
+func (s *Server) verifySignature(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, "AWS "):
+		return s.verifySignatureV2(r, auth)
+	case strings.HasPrefix(auth, v4Algorithm+" "):
+		return s.verifySignatureV4(r, auth)
+	default:
+		return errors.New("missing or unsupported authorization")
+	}
+}
+
+// 校验 V2 签名：Authorization: AWS AccessKey:Signature
+func (s *Server) verifySignatureV2(r *http.Request, auth string) error {
+	credential := strings.SplitN(auth[len("AWS "):], ":", 2)
+	if len(credential) != 2 || credential[0] != s.AccessKey {
+		return errors.New("the access key does not exist")
+	}
+
+	mac := hmac.New(sha1.New, []byte(s.SecretKey))
+	mac.Write([]byte(stringToSign(r)))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(credential[1])) {
+		return errors.New("the request signature we calculated does not match the signature you provided")
+	}
+	return nil
+}
+
+func stringToSign(r *http.Request) string {
+	date := r.Header.Get("Date")
+	if r.Header.Get("x-amz-date") != "" {
+		date = ""
+	}
+	lines := []string{
+		r.Method,
+		r.Header.Get("Content-MD5"),
+		r.Header.Get("Content-Type"),
+		date,
+	}
+
+	var amzHeaders []string
+	for name := range r.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			amzHeaders = append(amzHeaders, lower)
+		}
+	}
+	sort.Strings(amzHeaders)
+	for _, name := range amzHeaders {
+		values := append([]string(nil), r.Header.Values(name)...)
+		if strings.HasPrefix(name, "x-amz-meta-") {
+			for i, v := range values {
+				values[i] = strings.TrimSpace(v)
+			}
+		}
+		lines = append(lines, name+":"+strings.Join(values, ","))
+	}
+	return strings.Join(append(lines, canonicalizedResource(r)), "\n")
+}
+
+// 规范化资源：请求中原样编码的路径加上排序后的子资源
+func canonicalizedResource(r *http.Request) string {
+	path := requestPath(r)
+
+	type param struct{ key, value string }
+	var params []param
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			continue
+		}
+		lower := strings.ToLower(key)
+		if !subResources[lower] && !strings.HasPrefix(lower, "x-amz-") {
+			continue
+		}
+		var value string
+		if len(kv) == 2 {
+			value, _ = url.QueryUnescape(kv[1])
+		}
+		params = append(params, param{key, value})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].key < params[j].key })
+
+	for i, p := range params {
+		if i == 0 {
+			path += "?"
+		} else {
+			path += "&"
+		}
+		path += url.QueryEscape(p.key)
+		if p.value != "" {
+			path += "=" + p.value
+		}
+	}
+	return path
+}
+
+const v4Algorithm = "AWS4-HMAC-SHA256"
+
+// 校验 V4 签名：Authorization: AWS4-HMAC-SHA256 Credential=AccessKey/Date/Region/s3/aws4_request,SignedHeaders=...,Signature=...
+func (s *Server) verifySignatureV4(r *http.Request, auth string) error {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(auth[len(v4Algorithm)+1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	scope := strings.Split(fields["Credential"], "/")
+	if len(scope) != 5 || scope[3] != "s3" || scope[4] != "aws4_request" {
+		return errors.New("malformed credential")
+	}
+	if scope[0] != s.AccessKey {
+		return errors.New("the access key does not exist")
+	}
+	longDate := r.Header.Get("x-amz-date")
+	if longDate == "" {
+		// 没有 x-amz-date 时使用 Date 请求头
+		t, err := http.ParseTime(r.Header.Get("Date"))
+		if err != nil {
+			return errors.New("missing or invalid request date")
+		}
+		longDate = t.UTC().Format("20060102T150405Z")
+	}
+	if !strings.HasPrefix(longDate, scope[1]) {
+		return errors.New("x-amz-date does not match the credential scope")
+	}
+
+	canonicalRequest := canonicalRequestV4(r, strings.Split(fields["SignedHeaders"], ";"))
+	stringToSign := strings.Join([]string{
+		v4Algorithm,
+		longDate,
+		strings.Join(scope[1:], "/"),
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), scope[1])
+	for _, part := range scope[2:] {
+		key = hmacSHA256(key, part)
+	}
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return errors.New("the request signature we calculated does not match the signature you provided")
+	}
+	return nil
+}
+
+// 规范请求：请求中原样编码的路径和查询参数，加上参与签名的请求头
+func canonicalRequestV4(r *http.Request, signedHeaders []string) string {
+	path := requestPath(r)
+	var query []string
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		if pair != "" {
+			query = append(query, pair)
+		}
+	}
+	sort.Strings(query)
+
+	lines := []string{r.Method, path, strings.Join(query, "&")}
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		default:
+			values = r.Header.Values(name)
+		}
+		for _, value := range values {
+			lines = append(lines, name+":"+value)
+		}
+	}
+
+	payload := r.Header.Get("x-amz-content-sha256")
+	if payload == "" {
+		payload = "UNSIGNED-PAYLOAD"
+	}
+	return strings.Join(append(lines, "", strings.Join(signedHeaders, ";"), payload), "\n")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func base64MD5(data []byte) string {
+	sum := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// 请求中原样编码的路径，通过代理发送的请求 RequestURI 为包含协议和主机的绝对地址
+func requestPath(r *http.Request) string {
+	path := r.RequestURI
+	if r.URL.IsAbs() {
+		path = strings.TrimPrefix(path, r.URL.Scheme+"://"+r.URL.Host)
+	}
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
@@ -0,0 +1,190 @@
+package operation
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// ProgressEventType 进度事件类型
+type ProgressEventType int
+
+const (
+	// ProgressTransferred 传输了数据，重试时会撤销失败的尝试已计入的字节数。
+	// 传输数据的事件最多每 100 毫秒回调一次，期间的事件被合并
+	ProgressTransferred ProgressEventType = iota
+	// ProgressPartCompleted 完成一个分片的上传或一个分段的下载
+	ProgressPartCompleted
+	// ProgressRetry 一次尝试失败，随后会重试
+	ProgressRetry
+	// ProgressCompleted 操作结束，Err 为 nil 表示成功
+	ProgressCompleted
+)
+
+// ProgressEvent 上传、下载的进度事件
+type ProgressEvent struct {
+	Type ProgressEventType
+	// Op 操作名，如 upload、upload_reader、download_file
+	Op     string
+	Bucket string
+	Key    string
+	// TransferredBytes 已传输的字节数，续传时包含之前已完成的部分
+	TransferredBytes int64
+	// TotalBytes 总字节数，长度未知的流式上传为 -1
+	TotalBytes int64
+	// PartNumber 完成的分片号或分段号，仅用于 ProgressPartCompleted
+	PartNumber int
+	// Attempt 失败的是第几次尝试，仅用于 ProgressRetry
+	Attempt int
+	// Err ProgressRetry 时为本次尝试的错误，ProgressCompleted 时为操作的结果
+	Err error
+}
+
+// ProgressFunc 进度回调，传给 UploadWithProgress、DownloadFileWithProgress 等方法。
+// 同一次操作的事件依次回调，不会并发调用，回调时不阻塞其余并发的传输，但应尽快返回。
+// 多写上传时每个写入目标分别回调，以 Bucket 区分
+type ProgressFunc func(event ProgressEvent)
+
+// 传输数据的事件的最小回调间隔
+const progressInterval = 100 * time.Millisecond
+
+type progressFuncKey struct{}
+
+type progressKey struct{}
+
+// 进度回调在内部随上下文传递到各个集群和写入目标
+func withProgressFunc(ctx context.Context, fn ProgressFunc) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressFuncKey{}, fn)
+}
+
+// 一次操作的进度，为 nil 时不记录
+type progressTracker struct {
+	// mu 保护进度计数，callMu 保证回调依次执行，回调时不持有 mu
+	mu          sync.Mutex
+	callMu      sync.Mutex
+	fn          ProgressFunc
+	op          string
+	bucket      string
+	key         string
+	transferred int64
+	total       int64
+	lastEmit    time.Time
+}
+
+// 有进度回调时开始记录一次操作的进度，返回携带进度的上下文
+func startProgress(ctx context.Context, op, bucket, key string, total int64) (context.Context, *progressTracker) {
+	fn, ok := ctx.Value(progressFuncKey{}).(ProgressFunc)
+	if !ok || fn == nil {
+		return ctx, nil
+	}
+	t := &progressTracker{fn: fn, op: op, bucket: bucket, key: key, total: total}
+	return context.WithValue(ctx, progressKey{}, t), t
+}
+
+func progressFromContext(ctx context.Context) *progressTracker {
+	t, _ := ctx.Value(progressKey{}).(*progressTracker)
+	return t
+}
+
+// 加锁更新进度，释放锁后回调。throttle 为 true 时距上次回调不足 progressInterval 则只更新进度，
+// 之后的回调带上累计的字节数
+func (t *progressTracker) emit(event ProgressEvent, update func(), throttle bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if update != nil {
+		update()
+	}
+	now := time.Now()
+	if throttle && now.Sub(t.lastEmit) < progressInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastEmit = now
+	t.mu.Unlock()
+
+	t.callMu.Lock()
+	defer t.callMu.Unlock()
+	// 等待前一个回调期间进度可能已更新，回调最新的进度
+	t.mu.Lock()
+	event.Op, event.Bucket, event.Key = t.op, t.bucket, t.key
+	event.TransferredBytes, event.TotalBytes = t.transferred, t.total
+	t.mu.Unlock()
+	t.fn(event)
+}
+
+// 已传输的字节数增加 n，n 为负数时撤销
+func (t *progressTracker) add(n int64) {
+	if n == 0 {
+		return
+	}
+	t.emit(ProgressEvent{Type: ProgressTransferred}, func() {
+		t.transferred += n
+	}, true)
+}
+
+// 续传时重新设置已传输的字节数和总字节数
+func (t *progressTracker) reset(transferred, total int64) {
+	t.emit(ProgressEvent{Type: ProgressTransferred}, func() {
+		t.transferred, t.total = transferred, total
+	}, false)
+}
+
+func (t *progressTracker) partCompleted(partNumber int) {
+	t.emit(ProgressEvent{Type: ProgressPartCompleted, PartNumber: partNumber}, nil, false)
+}
+
+func (t *progressTracker) retry(attempt int, err error) {
+	t.emit(ProgressEvent{Type: ProgressRetry, Attempt: attempt, Err: err}, nil, false)
+}
+
+// 操作结束，流式上传结束时总字节数即为已传输的字节数
+func (t *progressTracker) finish(err error) {
+	t.emit(ProgressEvent{Type: ProgressCompleted, Err: err}, func() {
+		if err == nil && t.total < 0 {
+			t.total = t.transferred
+		}
+	}, false)
+}
+
+// 统计读取的字节数，一次尝试失败时调用 rewind 撤销
+func (t *progressTracker) reader(r io.Reader) *progressReader {
+	return &progressReader{r: r, tracker: t}
+}
+
+type progressReader struct {
+	r       io.Reader
+	tracker *progressTracker
+	n       int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.tracker.add(int64(n))
+	return n, err
+}
+
+func (r *progressReader) rewind() {
+	r.tracker.add(-r.n)
+	r.n = 0
+}
+
+// 有进度回调时统计 body 的读取，失败时撤销本次尝试计入的字节数
+func trackBody(ctx context.Context, body io.Reader, fn func(body io.Reader) error) error {
+	t := progressFromContext(ctx)
+	if t == nil {
+		return fn(body)
+	}
+	r := t.reader(body)
+	err := fn(r)
+	if err != nil {
+		r.rewind()
+	}
+	return err
+}
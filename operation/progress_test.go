@@ -0,0 +1,157 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 记录进度事件
+type recordProgress struct {
+	events []ProgressEvent
+}
+
+func (r *recordProgress) fn(event ProgressEvent) {
+	r.events = append(r.events, event)
+}
+
+func (r *recordProgress) count(typ ProgressEventType) int {
+	n := 0
+	for _, event := range r.events {
+		if event.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *recordProgress) last() ProgressEvent {
+	return r.events[len(r.events)-1]
+}
+
+func TestProgress_UploadDataRetry(t *testing.T) {
+	backend := &flakyBackend{Backend: NewMemoryBackend(), err: newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", ""), failures: 1}
+	uploader, err := NewUploader(&Config{Bucket: "bucket", Backend: backend, RetryPolicy: fastRetryPolicy(3)})
+	assert.NoError(t, err)
+
+	progress := &recordProgress{}
+	assert.NoError(t, uploader.UploadDataWithProgress(context.Background(), []byte("0123456789"), "key", progress.fn))
+	assert.Equal(t, 1, progress.count(ProgressRetry))
+	for _, event := range progress.events {
+		if event.Type == ProgressRetry {
+			assert.Equal(t, 1, event.Attempt)
+			// 失败的尝试已计入的字节数被撤销
+			assert.Equal(t, int64(0), event.TransferredBytes)
+		}
+	}
+
+	last := progress.last()
+	assert.Equal(t, ProgressCompleted, last.Type)
+	assert.NoError(t, last.Err)
+	assert.Equal(t, OpUploadData, last.Op)
+	assert.Equal(t, "bucket", last.Bucket)
+	assert.Equal(t, "key", last.Key)
+	assert.Equal(t, int64(10), last.TransferredBytes)
+	assert.Equal(t, int64(10), last.TotalBytes)
+}
+
+func TestProgress_UploadMultipart(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	uploader, err := NewUploader(&Config{Backend: NewMemoryBackend(), PartSize: 4, UpConcurrency: 2, MultipartThreshold: 1})
+	assert.NoError(t, err)
+	file, _ := newCheckpointTestFile(t, 2*partSize+10)
+
+	progress := &recordProgress{}
+	assert.NoError(t, uploader.UploadWithProgress(context.Background(), file, "key", progress.fn))
+	assert.Equal(t, 3, progress.count(ProgressPartCompleted))
+	var transferred int64
+	for _, event := range progress.events {
+		assert.Equal(t, int64(2*partSize+10), event.TotalBytes)
+		assert.True(t, event.TransferredBytes >= transferred)
+		transferred = event.TransferredBytes
+	}
+	assert.Equal(t, ProgressCompleted, progress.last().Type)
+	assert.Equal(t, int64(2*partSize+10), progress.last().TransferredBytes)
+}
+
+func TestProgress_UploadReader(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	uploader, err := NewUploader(&Config{Backend: NewMemoryBackend(), PartSize: 4, UpConcurrency: 2})
+	assert.NoError(t, err)
+	data := bytes.Repeat([]byte("x"), partSize+10)
+
+	progress := &recordProgress{}
+	assert.NoError(t, uploader.UploadReaderWithProgress(context.Background(), &streamReader{bytes.NewReader(data)}, "key", progress.fn))
+	assert.Equal(t, 2, progress.count(ProgressPartCompleted))
+	// 长度未知，结束时总字节数为已上传的字节数
+	assert.Equal(t, int64(-1), progress.events[0].TotalBytes)
+	assert.Equal(t, int64(partSize+10), progress.last().TransferredBytes)
+	assert.Equal(t, int64(partSize+10), progress.last().TotalBytes)
+
+	// 不使用进度回调
+	assert.NoError(t, uploader.UploadReader(bytes.NewReader(data), "key2"))
+	assert.NoError(t, uploader.UploadReaderWithProgress(context.Background(), bytes.NewReader(data), "key3", nil))
+}
+
+func TestProgress_DownloadFile(t *testing.T) {
+	backend := NewMemoryBackend()
+	assert.NoError(t, backend.PutObject(context.Background(), "key", bytes.NewReader([]byte("0123456789")), 10, nil))
+	downloader, err := NewDownloader(&Config{Backend: backend})
+	assert.NoError(t, err)
+
+	// 目标文件已存在时覆盖
+	path := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(path, []byte("0123456789abcdef"), 0644))
+	progress := &recordProgress{}
+	f, err := downloader.DownloadFileWithProgress(context.Background(), "key", path, progress.fn)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "0123456789", string(data))
+
+	assert.Equal(t, ProgressTransferred, progress.events[0].Type)
+	assert.Equal(t, int64(0), progress.events[0].TransferredBytes)
+	assert.Equal(t, int64(10), progress.events[0].TotalBytes)
+	assert.Equal(t, 1, progress.count(ProgressPartCompleted))
+	last := progress.last()
+	assert.Equal(t, ProgressCompleted, last.Type)
+	assert.Equal(t, OpDownloadFile, last.Op)
+	assert.Equal(t, int64(10), last.TransferredBytes)
+	assert.Equal(t, int64(10), last.TotalBytes)
+}
+
+// 每次最多读取 n 个字节
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	return r.r.Read(p)
+}
+
+func TestProgress_Throttle(t *testing.T) {
+	uploader, err := NewUploader(&Config{Backend: NewMemoryBackend()})
+	assert.NoError(t, err)
+	data := bytes.Repeat([]byte("x"), 1024*1024)
+
+	// 每读取 1KB 更新一次进度，传输数据的事件被合并
+	progress := &recordProgress{}
+	start := time.Now()
+	assert.NoError(t, uploader.UploadReaderWithProgress(context.Background(), &chunkReader{r: bytes.NewReader(data), n: 1024}, "key", progress.fn))
+	elapsed := time.Since(start)
+	assert.True(t, progress.count(ProgressTransferred) <= int(elapsed/progressInterval)+1, "%d events in %v", progress.count(ProgressTransferred), elapsed)
+	assert.Equal(t, ProgressCompleted, progress.last().Type)
+	assert.Equal(t, int64(len(data)), progress.last().TransferredBytes)
+}
@@ -0,0 +1,165 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 默认重试策略的参数
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 3 * time.Second
+)
+
+// RetryPolicy 重试策略，作用于上传、下载、列举、获取元信息和删除的每一次请求
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试的次数（包含第一次），默认 3，设为 1 表示不重试
+	MaxAttempts int
+	// InitialBackoff 第一次重试前的等待时间，之后每次翻倍，默认 100 毫秒
+	InitialBackoff time.Duration
+	// MaxBackoff 两次尝试之间等待时间的上限，默认 3 秒
+	MaxBackoff time.Duration
+	// AttemptTimeout 单次尝试的超时时间，返回 Body 的下载请求包含读取 Body 的时间，默认不限制
+	AttemptTimeout time.Duration
+	// Retryable 判断错误是否可以重试，默认为 IsRetryable
+	Retryable func(err error) bool
+}
+
+// IsRetryable 默认的可重试错误：网络错误、单次尝试超时、数据校验不一致、408、429 和 5xx
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrChecksumMismatch) {
+		return true
+	}
+	if code := statusCodeOf(err); code != 0 {
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// 补全未设置的字段
+func newRetryPolicy(p *RetryPolicy) *RetryPolicy {
+	policy := RetryPolicy{}
+	if p != nil {
+		policy = *p
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = defaultInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultMaxBackoff
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = IsRetryable
+	}
+	return &policy
+}
+
+// 第 retry 次重试前的等待时间，指数增长，并在 [d/2, d) 之间随机抖动
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// 等待 d，ctx 结束时提前返回其错误
+func (p *RetryPolicy) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 单次尝试的上下文
+func (p *RetryPolicy) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.AttemptTimeout > 0 {
+		return context.WithTimeout(ctx, p.AttemptTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// ctx 未结束且错误可以重试
+func (p *RetryPolicy) shouldRetry(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && p.Retryable(err)
+}
+
+// 按策略执行 fn，直到成功、遇到不可重试的错误、次数用完或 ctx 结束
+func (p *RetryPolicy) do(ctx context.Context, log *fieldLogger, fn func(ctx context.Context) error) error {
+	return p.doStream(ctx, log, func(ctx context.Context, cancel context.CancelFunc) error {
+		defer cancel()
+		return fn(ctx)
+	})
+}
+
+// 与 do 相同，但成功时由 fn 负责调用 cancel，用于返回 Body 的请求
+func (p *RetryPolicy) doStream(ctx context.Context, log *fieldLogger, fn func(ctx context.Context, cancel context.CancelFunc) error) error {
+	var (
+		err  error
+		span = spanFromContext(ctx)
+	)
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		span.SetAttributes(Attribute{Key: "attempts", Value: attempt + 1})
+		if attempt > 0 {
+			if sleepErr := p.sleep(ctx, p.backoff(attempt)); sleepErr != nil {
+				return retryInterrupted(sleepErr, err)
+			}
+		}
+		attemptCtx, cancel := p.attemptContext(ctx)
+		if err = fn(attemptCtx, cancel); err == nil {
+			return nil
+		}
+		cancel()
+		if !p.shouldRetry(ctx, err) {
+			return err
+		}
+		log.warn("attempt failed", "attempt", attempt+1, "error", err)
+		if attempt+1 < p.MaxAttempts {
+			progressFromContext(ctx).retry(attempt+1, err)
+		}
+	}
+	return err
+}
+
+// 等待重试时 ctx 结束，返回 ctx 的错误，并在信息中带上最后一次尝试的错误
+func retryInterrupted(ctxErr, lastErr error) error {
+	return fmt.Errorf("%w while waiting to retry, last attempt: %v", ctxErr, lastErr)
+}
+
+// Body 关闭时结束对应的尝试
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
@@ -0,0 +1,221 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 前 failures 次请求返回 err 的存储后端
+type flakyBackend struct {
+	Backend
+	err      error
+	failures int
+	calls    int
+}
+
+func (b *flakyBackend) fail() error {
+	b.calls++
+	if b.calls <= b.failures {
+		return b.err
+	}
+	return nil
+}
+
+func (b *flakyBackend) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	if err := b.fail(); err != nil {
+		// 读取部分数据，重试时需要从头开始
+		io.CopyN(io.Discard, body, 1)
+		return err
+	}
+	return b.Backend.PutObject(ctx, key, body, size, opts)
+}
+
+func (b *flakyBackend) HeadObject(ctx context.Context, key string) (*Entry, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	return b.Backend.HeadObject(ctx, key)
+}
+
+// 第一次下载阻塞到单次尝试超时的存储后端
+type slowBackend struct {
+	Backend
+	calls int
+}
+
+func (b *slowBackend) GetObject(ctx context.Context, key string, opts *GetOptions) (*GetObjectOutput, error) {
+	b.calls++
+	if b.calls == 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return b.Backend.GetObject(ctx, key, opts)
+}
+
+func fastRetryPolicy(attempts int) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, IsRetryable(nil))
+	assert.True(t, IsRetryable(newObsError(http.StatusInternalServerError, "InternalError", "")))
+	assert.True(t, IsRetryable(newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")))
+	assert.True(t, IsRetryable(newObsError(http.StatusTooManyRequests, "SlowDown", "")))
+	assert.False(t, IsRetryable(newObsError(http.StatusNotFound, "NoSuchKey", "")))
+	assert.False(t, IsRetryable(newObsError(http.StatusForbidden, "AccessDenied", "")))
+	assert.True(t, IsRetryable(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}))
+	assert.True(t, IsRetryable(context.DeadlineExceeded))
+	assert.True(t, IsRetryable(io.ErrUnexpectedEOF))
+	assert.True(t, IsRetryable(fmt.Errorf("sha256 mismatch: %w", ErrChecksumMismatch)))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(&os.PathError{Op: "open", Path: "file", Err: os.ErrNotExist}))
+	assert.False(t, IsRetryable(ErrClientNotInitialized))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := newRetryPolicy(&RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	assert.Equal(t, defaultMaxAttempts, policy.MaxAttempts)
+	for retry, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		d := policy.backoff(retry)
+		assert.True(t, d >= max/2 && d <= max, "retry %d: %v", retry, d)
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	retryable := newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")
+	policy := newRetryPolicy(fastRetryPolicy(3))
+
+	calls := 0
+	err := policy.do(context.Background(), newFieldLogger(&Config{}), func(ctx context.Context) error {
+		calls++
+		return retryable
+	})
+	assert.Equal(t, retryable, err)
+	assert.Equal(t, 3, calls)
+
+	// 不可重试的错误直接返回
+	calls = 0
+	err = policy.do(context.Background(), newFieldLogger(&Config{}), func(ctx context.Context) error {
+		calls++
+		return ErrNotFound
+	})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 1, calls)
+
+	// ctx 取消后不再重试
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	err = policy.do(ctx, newFieldLogger(&Config{}), func(ctx context.Context) error {
+		calls++
+		cancel()
+		return retryable
+	})
+	assert.Equal(t, retryable, err)
+	assert.Equal(t, 1, calls)
+
+	// 等待重试时 ctx 结束，返回 ctx 的错误
+	calls = 0
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	slow := newRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute})
+	err = slow.do(ctx, newFieldLogger(&Config{}), func(ctx context.Context) error {
+		calls++
+		return retryable
+	})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.Equal(t, 1, calls)
+
+	// 自定义可重试错误
+	calls = 0
+	policy = newRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, Retryable: func(err error) bool {
+		return errors.Is(err, ErrNotFound)
+	}})
+	err = policy.do(context.Background(), newFieldLogger(&Config{}), func(ctx context.Context) error {
+		calls++
+		return ErrNotFound
+	})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestUploader_Retry(t *testing.T) {
+	memory := NewMemoryBackend()
+	backend := &flakyBackend{Backend: memory, err: newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", ""), failures: 2}
+	uploader, err := NewUploader(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(3)})
+	assert.NoError(t, err)
+
+	err = uploader.UploadData([]byte("data"), "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, backend.calls)
+
+	file := t.TempDir() + "/file"
+	assert.NoError(t, os.WriteFile(file, []byte("file data"), 0644))
+	backend.calls = 0
+	err = uploader.Upload(file, "file")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, backend.calls)
+
+	output, err := memory.GetObject(context.Background(), "file", nil)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(output.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "file data", string(data))
+
+	// 次数用完后返回最后一次的错误
+	backend.calls = 0
+	backend.failures = 5
+	err = uploader.UploadData([]byte("data"), "key")
+	assert.Equal(t, http.StatusServiceUnavailable, statusCodeOf(err))
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestLister_Retry(t *testing.T) {
+	memory := NewMemoryBackend()
+	assert.NoError(t, memory.PutObject(context.Background(), "key", strings.NewReader("data"), 4, nil))
+	backend := &flakyBackend{Backend: memory, err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}, failures: 1}
+	lister, err := NewLister(&Config{Backend: backend, RetryPolicy: fastRetryPolicy(2)})
+	assert.NoError(t, err)
+
+	entry, err := lister.Stat("key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), entry.Fsize)
+	assert.Equal(t, 2, backend.calls)
+
+	// 404 不重试
+	backend.calls = 0
+	backend.failures = 0
+	_, err = lister.Stat("not-exist")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestDownloader_AttemptTimeout(t *testing.T) {
+	memory := NewMemoryBackend()
+	assert.NoError(t, memory.PutObject(context.Background(), "key", strings.NewReader("data"), 4, nil))
+	backend := &slowBackend{Backend: memory}
+	downloader, err := NewDownloader(&Config{Backend: backend, RetryPolicy: &RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+	}})
+	assert.NoError(t, err)
+
+	// 返回的 Body 在关闭前不受单次尝试结束的影响
+	reader, err := downloader.DownloadRaw("key", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, backend.calls)
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	assert.NoError(t, reader.Close())
+}
@@ -22,24 +22,24 @@ func getBucket() string {
 	return os.Getenv("QINIU_TEST_BUCKET")
 }
 
+// 未设置 QINIU_KODO_TEST 时，所有测试共用一个内存存储后端
+var testBackend Backend
+
 func getConfig1() *Config {
 	config := &Config{
 		Ak:       getAccessKey(),
 		Sk:       getSecretKey(),
 		EndPoint: getEndPoint(),
 		Bucket:   getBucket(),
+		Backend:  testBackend,
 	}
 	return config
 }
 
-// 检查是否应该跳过测试
-func checkSkipTest(t *testing.T) {
-	if os.Getenv("QINIU_KODO_TEST") == "" {
-		t.Skip("skipping test in short mode.")
-	}
-}
-
 func TestMain(m *testing.M) {
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
+	if os.Getenv("QINIU_KODO_TEST") == "" {
+		testBackend = NewMemoryBackend()
+	}
 	os.Exit(m.Run())
 }
@@ -0,0 +1,53 @@
+package operation
+
+import (
+	"context"
+	"time"
+)
+
+// 日志、指标和链路追踪
+type telemetry struct {
+	log     *fieldLogger
+	metrics MetricsSink
+	tracer  Tracer
+}
+
+func newTelemetry(c *Config) *telemetry {
+	var tracer Tracer = nopTracer{}
+	if c.Tracer != nil {
+		tracer = c.Tracer
+	}
+	return &telemetry{log: newFieldLogger(c), metrics: newMetricsSink(c), tracer: tracer}
+}
+
+// 开始一次操作，keysAndValues 同时作为日志字段和 span 属性
+func (t *telemetry) start(ctx context.Context, op string, keysAndValues ...interface{}) (context.Context, *operationRun) {
+	log := t.log.with(append([]interface{}{"op", op}, keysAndValues...)...)
+	ctx, span := t.span(ctx, op, log.fields...)
+	return ctx, &operationRun{op: op, start: time.Now(), log: log, metrics: t.metrics, span: span}
+}
+
+// 开始一个只用于链路追踪的 span，用于包含多个操作的调用和分片、批次
+func (t *telemetry) span(ctx context.Context, name string, keysAndValues ...interface{}) (context.Context, Span) {
+	ctx, span := t.tracer.Start(ctx, "obs."+name)
+	span.SetAttributes(attributesOf(keysAndValues)...)
+	return contextWithSpan(ctx, span), span
+}
+
+// 进行中的一次操作
+type operationRun struct {
+	op      string
+	start   time.Time
+	log     *fieldLogger
+	metrics MetricsSink
+	span    Span
+}
+
+// 结束操作，记录指标、结果日志并结束 span，bytes 为传输的字节数
+func (o *operationRun) end(bytes int64, err error) {
+	duration := time.Since(o.start)
+	o.metrics.Observe(o.op, err, bytes, duration)
+	o.log.finish(o.op, duration, bytes, err)
+	o.span.SetAttributes(Attribute{Key: "bytes", Value: bytes})
+	endSpan(o.span, err)
+}
@@ -0,0 +1,90 @@
+package operation
+
+import "context"
+
+// Tracer 链路追踪接口，每次上传、下载、列举等操作创建一个 span，
+// 分片上传的每个分片、批量操作的每一批创建子 span。接入 OpenTelemetry 时可以这样实现：
+//
+//	type otelTracer struct{ tracer trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, operation.Span) {
+//		ctx, span := t.tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) SetAttributes(attrs ...operation.Attribute) {
+//		for _, attr := range attrs {
+//			s.Span.SetAttributes(attribute.String(attr.Key, fmt.Sprint(attr.Value)))
+//		}
+//	}
+//
+//	func (s otelSpan) RecordError(err error) {
+//		s.Span.RecordError(err)
+//		s.Span.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (s otelSpan) End() { s.Span.End() }
+type Tracer interface {
+	// Start 开始一个 span，返回携带该 span 的上下文
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 链路追踪中的一个操作
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute span 的属性，使用的属性：op、bucket、key、offset、size、parts、attempts、bytes 等
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// 默认不追踪
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {}
+func (nopSpan) RecordError(error)          {}
+func (nopSpan) End()                       {}
+
+type spanContextKey struct{}
+
+// 在上下文中记录当前的 span，重试时在其上记录尝试次数
+func contextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+func spanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanContextKey{}).(Span); ok {
+		return span
+	}
+	return nopSpan{}
+}
+
+// 将交替出现的字段名和值转换为属性
+func attributesOf(keysAndValues []interface{}) []Attribute {
+	attrs := make([]Attribute, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key, _ := keysAndValues[i].(string)
+		attrs = append(attrs, Attribute{Key: key, Value: keysAndValues[i+1]})
+	}
+	return attrs
+}
+
+// 结束 span，err 不为空时记录错误
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,130 @@
+package operation
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordSpan struct {
+	name   string
+	parent *recordSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+	mu     *sync.Mutex
+}
+
+func (s *recordSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordSpan) RecordError(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+func (s *recordSpan) End() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+}
+
+type recordSpanKey struct{}
+
+// 记录所有 span 的 Tracer
+type recordTracer struct {
+	mu    sync.Mutex
+	spans []*recordSpan
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(recordSpanKey{}).(*recordSpan)
+	span := &recordSpan{name: name, parent: parent, attrs: make(map[string]interface{}), mu: &t.mu}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, recordSpanKey{}, span), span
+}
+
+func (t *recordTracer) find(name string) []*recordSpan {
+	var spans []*recordSpan
+	for _, span := range t.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestTracer_Multipart(t *testing.T) {
+	tracer := &recordTracer{}
+	uploader, err := NewUploader(&Config{Bucket: "bucket", Backend: NewMemoryBackend(), Tracer: tracer, PartSize: 16})
+	assert.NoError(t, err)
+
+	file := t.TempDir() + "/file"
+	assert.NoError(t, os.WriteFile(file, make([]byte, 50*1024*1024+1), 0644))
+	assert.NoError(t, uploader.Upload(file, "key"))
+
+	uploads := tracer.find("obs.upload")
+	assert.Len(t, uploads, 1)
+	upload := uploads[0]
+	assert.True(t, upload.ended)
+	assert.Equal(t, "bucket", upload.attrs["bucket"])
+	assert.Equal(t, "key", upload.attrs["key"])
+	assert.Equal(t, 4, upload.attrs["parts"])
+	assert.Equal(t, int64(50*1024*1024+1), upload.attrs["bytes"])
+
+	parts := tracer.find("obs.upload_part")
+	assert.Len(t, parts, 4)
+	for _, part := range parts {
+		assert.Equal(t, upload, part.parent)
+		assert.True(t, part.ended)
+		assert.Equal(t, 1, part.attrs["attempts"])
+	}
+}
+
+func TestTracer_Operations(t *testing.T) {
+	tracer := &recordTracer{}
+	backend := &failingBackend{Backend: NewMemoryBackend(), err: newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")}
+	assert.NoError(t, backend.PutObject(context.Background(), "key", strings.NewReader("data"), 4, nil))
+	config := &Config{Backend: backend, Tracer: tracer, RetryPolicy: fastRetryPolicy(2)}
+
+	// 重试次数和错误记录在 span 上
+	downloader, err := NewDownloader(config)
+	assert.NoError(t, err)
+	_, _, err = downloader.DownloadRangeBytes("key", 1, 2)
+	assert.Error(t, err)
+	span := tracer.find("obs.download_range")[0]
+	assert.Equal(t, int64(1), span.attrs["offset"])
+	assert.Equal(t, int64(2), span.attrs["size"])
+	assert.Equal(t, 2, span.attrs["attempts"])
+	assert.Equal(t, err, span.err)
+
+	// 批量操作的每一批创建子 span
+	lister, err := NewLister(&Config{Backend: backend, Tracer: tracer, BatchSize: 2})
+	assert.NoError(t, err)
+	_, err = lister.ListStat([]string{"key", "a", "b"})
+	assert.NoError(t, err)
+	listStat := tracer.find("obs.list_stat")[0]
+	batches := tracer.find("obs.stat_batch")
+	assert.Len(t, batches, 2)
+	for _, batch := range batches {
+		assert.Equal(t, listStat, batch.parent)
+	}
+	stats := tracer.find("obs.stat")
+	assert.Len(t, stats, 3)
+	for _, stat := range stats {
+		assert.Contains(t, batches, stat.parent)
+	}
+}
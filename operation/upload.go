@@ -1,8 +1,23 @@
 package operation
 
+import (
+	"context"
+	"io"
+)
+
 type clusterUploader interface {
-	upload(file string, key string) error
-	uploadData(data []byte, key string) error
+	upload(ctx context.Context, file string, key string) error
+	uploadData(ctx context.Context, data []byte, key string) error
+	uploadReader(ctx context.Context, r io.Reader, key string) error
+	wait()
+}
+
+// 设置了 Config.Replication 时使用多写上传
+func newClusterUploader(c *Config) (clusterUploader, error) {
+	if c.Replication != nil {
+		return newReplicatedUploader(c)
+	}
+	return newSingleClusterUploader(c)
 }
 
 // Uploader 上传器
@@ -10,17 +25,90 @@ type Uploader struct {
 	clusterUploader
 }
 
-// NewUploader 根据配置创建上传器
-func NewUploader(c *Config) *Uploader {
-	return &Uploader{newSingleClusterUploader(c)}
+// NewUploader 根据配置创建上传器，设置了 Config.Replication 时每个对象同时写入多个目标
+func NewUploader(c *Config) (*Uploader, error) {
+	uploader, err := newClusterUploader(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Uploader{uploader}, nil
+}
+
+// NewMultiClustersUploader 根据多集群配置创建上传器，按路由规则将 key 分配到各个集群
+func NewMultiClustersUploader(c *MultiClustersConfig) (*Uploader, error) {
+	uploader, err := newMultiClustersUploader(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Uploader{uploader}, nil
 }
 
 // UploadData 上传内存数据到指定对象中
 func (p *Uploader) UploadData(data []byte, key string) (err error) {
-	return p.uploadData(data, key)
+	return p.UploadDataContext(context.Background(), data, key)
+}
+
+// UploadDataContext 上传内存数据到指定对象中，ctx 取消时中止上传
+func (p *Uploader) UploadDataContext(ctx context.Context, data []byte, key string) (err error) {
+	return p.uploadData(ctx, data, key)
+}
+
+// UploadDataWithProgress 上传内存数据到指定对象中，通过 fn 回调上传进度，ctx 取消时中止上传
+func (p *Uploader) UploadDataWithProgress(ctx context.Context, data []byte, key string, fn ProgressFunc) (err error) {
+	return p.uploadData(withProgressFunc(ctx, fn), data, key)
 }
 
 // Upload 上传指定文件到指定对象中
 func (p *Uploader) Upload(file string, key string) (err error) {
-	return p.upload(file, key)
+	return p.UploadContext(context.Background(), file, key)
+}
+
+// UploadContext 上传指定文件到指定对象中，ctx 取消时中止上传
+func (p *Uploader) UploadContext(ctx context.Context, file string, key string) (err error) {
+	return p.upload(ctx, file, key)
+}
+
+// UploadWithProgress 上传指定文件到指定对象中，通过 fn 回调上传进度，ctx 取消时中止上传
+func (p *Uploader) UploadWithProgress(ctx context.Context, file string, key string, fn ProgressFunc) (err error) {
+	return p.upload(withProgressFunc(ctx, fn), file, key)
+}
+
+// UploadReader 流式上传长度未知的数据到指定对象中，数据超过一个分片时自动使用分片上传，
+// 内存占用不超过 UpConcurrency 个分片的大小
+func (p *Uploader) UploadReader(r io.Reader, key string) (err error) {
+	return p.UploadReaderContext(context.Background(), r, key)
+}
+
+// UploadReaderContext 流式上传长度未知的数据到指定对象中，ctx 取消时中止上传
+func (p *Uploader) UploadReaderContext(ctx context.Context, r io.Reader, key string) (err error) {
+	return p.uploadReader(ctx, r, key)
+}
+
+// UploadReaderWithProgress 流式上传长度未知的数据到指定对象中，通过 fn 回调上传进度，ctx 取消时中止上传
+func (p *Uploader) UploadReaderWithProgress(ctx context.Context, r io.Reader, key string, fn ProgressFunc) (err error) {
+	return p.uploadReader(withProgressFunc(ctx, fn), r, key)
+}
+
+// UploadReplicated 上传指定文件到指定对象中，成功和失败时都返回多写各个目标的结果，ctx 取消时中止上传。
+// 没有设置 Config.Replication 时结果为空，primary 策略下异步写入的结果在 Wait 返回后才是最终结果
+func (p *Uploader) UploadReplicated(ctx context.Context, file string, key string) (results []*TargetResult, err error) {
+	err = p.upload(withReplicationResults(ctx, &results), file, key)
+	return
+}
+
+// UploadDataReplicated 上传内存数据到指定对象中，返回多写各个目标的结果，见 UploadReplicated
+func (p *Uploader) UploadDataReplicated(ctx context.Context, data []byte, key string) (results []*TargetResult, err error) {
+	err = p.uploadData(withReplicationResults(ctx, &results), data, key)
+	return
+}
+
+// UploadReaderReplicated 流式上传长度未知的数据到指定对象中，返回多写各个目标的结果，见 UploadReplicated
+func (p *Uploader) UploadReaderReplicated(ctx context.Context, r io.Reader, key string) (results []*TargetResult, err error) {
+	err = p.uploadReader(withReplicationResults(ctx, &results), r, key)
+	return
+}
+
+// Wait 等待多写 primary 策略下的异步写入完成，没有异步写入时直接返回
+func (p *Uploader) Wait() {
+	p.wait()
 }
@@ -0,0 +1,372 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CheckpointStore 分片上传断点的存储，断点内容为 JSON
+type CheckpointStore interface {
+	// Load 读取断点，不存在时返回 ErrNotFound
+	Load(ctx context.Context, bucket, key string) ([]byte, error)
+	// Save 保存断点，覆盖已有的断点
+	Save(ctx context.Context, bucket, key string, data []byte) error
+	// Delete 删除断点，不存在时不返回错误
+	Delete(ctx context.Context, bucket, key string) error
+}
+
+// 本地目录中的断点
+type localCheckpointStore struct {
+	dir string
+}
+
+// NewLocalCheckpointStore 将断点保存在本地目录中，文件名为存储空间和对象名的哈希
+func NewLocalCheckpointStore(dir string) CheckpointStore {
+	return &localCheckpointStore{dir: dir}
+}
+
+func (s *localCheckpointStore) path(bucket, key string) string {
+	sum := sha256.Sum256([]byte(bucket + "/" + key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *localCheckpointStore) Load(ctx context.Context, bucket, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *localCheckpointStore) Save(ctx context.Context, bucket, key string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(bucket, key), data)
+}
+
+func (s *localCheckpointStore) Delete(ctx context.Context, bucket, key string) error {
+	err := os.Remove(s.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 存储服务中与对象并列的断点对象
+type objectCheckpointStore struct {
+	backend Backend
+	prefix  string
+}
+
+// NewObjectCheckpointStore 将断点保存为 c 所指存储空间中的对象，对象名为 prefix + bucket + "/" + key + ".checkpoint.json"，
+// 多个存储空间可以共用同一个断点存储
+func NewObjectCheckpointStore(c *Config, prefix string) (CheckpointStore, error) {
+	backend, err := newBackend(c)
+	if err != nil {
+		return nil, err
+	}
+	return &objectCheckpointStore{backend: backend, prefix: prefix}, nil
+}
+
+func (s *objectCheckpointStore) name(bucket, key string) string {
+	return s.prefix + bucket + "/" + key + ".checkpoint.json"
+}
+
+func (s *objectCheckpointStore) Load(ctx context.Context, bucket, key string) ([]byte, error) {
+	output, err := s.backend.GetObject(ctx, s.name(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+func (s *objectCheckpointStore) Save(ctx context.Context, bucket, key string, data []byte) error {
+	return s.backend.PutObject(ctx, s.name(bucket, key), bytes.NewReader(data), int64(len(data)), nil)
+}
+
+func (s *objectCheckpointStore) Delete(ctx context.Context, bucket, key string) error {
+	err := s.backend.DeleteObject(ctx, s.name(bucket, key))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// 与源文件并列的断点文件，Config.CheckpointBesideFile 为 true 且未设置 Config.CheckpointStore 时使用
+type fileCheckpointStore struct {
+	path string
+}
+
+func newFileCheckpointStore(file string) CheckpointStore {
+	return &fileCheckpointStore{path: file + ".uploadfile_record"}
+}
+
+// 断点中记录了存储空间和对象名，与本次上传不匹配时不会续传，这里不区分 bucket 和 key
+func (s *fileCheckpointStore) Load(ctx context.Context, bucket, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *fileCheckpointStore) Save(ctx context.Context, bucket, key string, data []byte) error {
+	return writeFileAtomic(s.path, data)
+}
+
+func (s *fileCheckpointStore) Delete(ctx context.Context, bucket, key string) error {
+	err := os.Remove(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 分片上传文件的断点
+type uploadCheckpoint struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id"`
+	// File 源文件的路径、大小和修改时间，任一变化时断点失效
+	File    string `json:"file"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	// PartSize 分片大小变化时断点失效
+	PartSize int64            `json:"part_size"`
+	Parts    []checkpointPart `json:"parts"`
+}
+
+type checkpointPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+func newUploadCheckpoint(bucket, key, file string, info os.FileInfo, partSize int64) *uploadCheckpoint {
+	return &uploadCheckpoint{
+		Bucket:   bucket,
+		Key:      key,
+		File:     file,
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		PartSize: partSize,
+	}
+}
+
+// 断点是否对应同一个源文件和分片方式
+func (cp *uploadCheckpoint) matches(other *uploadCheckpoint) bool {
+	return cp.Bucket == other.Bucket && cp.Key == other.Key && cp.File == other.File &&
+		cp.Size == other.Size && cp.ModTime == other.ModTime && cp.PartSize == other.PartSize &&
+		cp.UploadID != ""
+}
+
+// 已完成的分片，按分片号索引
+func (cp *uploadCheckpoint) completed() map[int]Part {
+	parts := make(map[int]Part, len(cp.Parts))
+	for _, part := range cp.Parts {
+		parts[part.PartNumber] = Part{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size}
+	}
+	return parts
+}
+
+// 读取断点，不存在、无法解析或与当前上传不匹配时返回 nil
+func (p *singleClusterUploader) loadCheckpoint(ctx context.Context, log *fieldLogger, store CheckpointStore, want *uploadCheckpoint) *uploadCheckpoint {
+	data, err := store.Load(ctx, want.Bucket, want.Key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.warn("load checkpoint failed", "error", err)
+		}
+		return nil
+	}
+	cp := &uploadCheckpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		log.warn("invalid checkpoint", "error", err)
+		return nil
+	}
+	if !cp.matches(want) {
+		log.debug("checkpoint does not match source file", "upload_id", cp.UploadID)
+		return nil
+	}
+	return cp
+}
+
+// 分片在源文件中的大小，分片号超出文件范围时返回 0
+func (cp *uploadCheckpoint) partSize(partNumber int) int64 {
+	offset := int64(partNumber-1) * cp.PartSize
+	if partNumber < 1 || offset >= cp.Size {
+		return 0
+	}
+	if cp.Size-offset < cp.PartSize {
+		return cp.Size - offset
+	}
+	return cp.PartSize
+}
+
+// 服务端的分片是否与源文件中对应的部分一致，ETag 不是内容的 MD5 时无法校验，视为不一致
+func (cp *uploadCheckpoint) verifyPart(f io.ReaderAt, part Part) bool {
+	size := cp.partSize(part.PartNumber)
+	if size == 0 || size != part.Size {
+		return false
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, int64(part.PartNumber-1)*cp.PartSize, size)); err != nil {
+		return false
+	}
+	return strings.EqualFold(strings.Trim(part.ETag, `"`), hex.EncodeToString(h.Sum(nil)))
+}
+
+// 以服务端已上传的分片为准更新断点：断点中记录的分片 ETag 一致时沿用，
+// 未记录的分片（如保存断点前进程退出）校验与源文件一致后沿用，其余分片重新上传。
+// 后端不支持列举分片时保持断点不变，分片上传不存在时返回 ErrNotFound
+func (p *singleClusterUploader) reconcileParts(ctx context.Context, log *fieldLogger, f io.ReaderAt, cp *uploadCheckpoint) error {
+	lister, ok := p.backend.(MultipartLister)
+	if !ok {
+		return nil
+	}
+	var parts []Part
+	err := p.retry.do(ctx, log, func(ctx context.Context) (err error) {
+		parts, err = lister.ListParts(ctx, cp.Key, cp.UploadID)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	recorded := cp.completed()
+	cp.Parts = nil
+	for _, part := range parts {
+		r, ok := recorded[part.PartNumber]
+		if ok && strings.Trim(r.ETag, `"`) == strings.Trim(part.ETag, `"`) && r.Size == part.Size || cp.verifyPart(f, part) {
+			cp.Parts = append(cp.Parts, checkpointPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size})
+		}
+	}
+	return nil
+}
+
+// 断点丢失时从服务端查找同一对象上未完成的分片上传，从最新的开始依次列举分片，
+// 第一个存在与源文件一致的分片的分片上传作为断点，找不到时返回 nil
+func (p *singleClusterUploader) recoverCheckpoint(ctx context.Context, log *fieldLogger, f io.ReaderAt, want *uploadCheckpoint) *uploadCheckpoint {
+	lister, ok := p.backend.(MultipartLister)
+	if !ok {
+		return nil
+	}
+	var uploads []MultipartUpload
+	err := p.retry.do(ctx, log, func(ctx context.Context) (err error) {
+		uploads, err = lister.ListMultipartUploads(ctx, want.Key)
+		return
+	})
+	if err != nil {
+		log.warn("list multipart uploads failed", "error", err)
+		return nil
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Initiated.After(uploads[j].Initiated) })
+
+	for _, upload := range uploads {
+		if upload.Key != want.Key {
+			continue
+		}
+		cp := *want
+		cp.UploadID = upload.UploadID
+		if err = p.reconcileParts(ctx, log, f, &cp); err != nil {
+			log.warn("list parts failed", "upload_id", upload.UploadID, "error", err)
+			continue
+		}
+		if len(cp.Parts) > 0 {
+			return &cp
+		}
+	}
+	return nil
+}
+
+// 分片上传文件并记录断点，失败时保留分片上传和断点，下次上传同一文件时只上传未完成的分片。
+// 断点丢失时从服务端列举的分片中恢复与源文件一致的部分
+func (p *singleClusterUploader) uploadWithCheckpoint(ctx context.Context, log *fieldLogger, store CheckpointStore, file string, f io.ReaderAt, info os.FileInfo, key string) error {
+	want := newUploadCheckpoint(p.bucket, key, file, info, p.partSize)
+	cp := p.loadCheckpoint(ctx, log, store, want)
+	if cp != nil {
+		err := p.reconcileParts(ctx, log, f, cp)
+		if errors.Is(err, ErrNotFound) {
+			// 分片上传已被取消或过期，重新上传
+			log.warn("multipart upload in checkpoint no longer exists", "upload_id", cp.UploadID, "error", err)
+			cp = nil
+		} else if err != nil {
+			log.warn("list parts failed, resume from checkpoint", "upload_id", cp.UploadID, "error", err)
+		}
+	} else {
+		cp = p.recoverCheckpoint(ctx, log, f, want)
+	}
+	if cp != nil {
+		log.debug("resume multipart upload", "upload_id", cp.UploadID, "parts", len(cp.Parts))
+		err := p.uploadCheckpointParts(ctx, log, store, f, cp)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		// 分片上传已被取消或过期，重新上传
+		log.warn("multipart upload in checkpoint no longer exists", "upload_id", cp.UploadID, "error", err)
+	}
+
+	opts, err := p.multipartOptions(f, want.Size)
+	if err != nil {
+		return err
+	}
+	err = p.retry.do(ctx, log, func(ctx context.Context) (err error) {
+		want.UploadID, err = p.backend.InitiateMultipartUpload(ctx, key, opts)
+		return
+	})
+	if err != nil {
+		return err
+	}
+	return p.uploadCheckpointParts(ctx, log, store, f, want)
+}
+
+// 上传断点中未完成的分片，每完成一个分片保存一次断点，全部完成后合并分片并删除断点
+func (p *singleClusterUploader) uploadCheckpointParts(ctx context.Context, log *fieldLogger, store CheckpointStore, f io.ReaderAt, cp *uploadCheckpoint) error {
+	var mu sync.Mutex
+	save := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		data, err := json.Marshal(cp)
+		if err == nil {
+			err = store.Save(ctx, cp.Bucket, cp.Key, data)
+		}
+		if err != nil {
+			log.warn("save checkpoint failed", "upload_id", cp.UploadID, "error", err)
+		}
+	}
+	save()
+
+	parts, err := p.uploadFileParts(ctx, log, f, cp.Size, cp.Key, cp.UploadID, cp.completed(), func(part Part) {
+		mu.Lock()
+		cp.Parts = append(cp.Parts, checkpointPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size})
+		mu.Unlock()
+		save()
+	})
+	if err != nil {
+		return err
+	}
+
+	spanFromContext(ctx).SetAttributes(Attribute{Key: "parts", Value: len(parts)})
+	err = p.retry.do(ctx, log, func(ctx context.Context) error {
+		return p.backend.CompleteMultipartUpload(ctx, cp.Key, cp.UploadID, parts)
+	})
+	if err != nil {
+		return err
+	}
+	if err = store.Delete(ctx, cp.Bucket, cp.Key); err != nil {
+		log.warn("delete checkpoint failed", "upload_id", cp.UploadID, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCheckpointStore(t *testing.T, store CheckpointStore) {
+	ctx := context.Background()
+	_, err := store.Load(ctx, "bucket", "dir/key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, store.Save(ctx, "bucket", "dir/key", []byte("v1")))
+	assert.NoError(t, store.Save(ctx, "bucket", "dir/key", []byte("v2")))
+	data, err := store.Load(ctx, "bucket", "dir/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	// 不同存储空间中的同名对象互不影响
+	_, err = store.Load(ctx, "other", "dir/key")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.Save(ctx, "other", "dir/key", []byte("other")))
+	assert.NoError(t, store.Delete(ctx, "other", "dir/key"))
+	data, err = store.Load(ctx, "bucket", "dir/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	assert.NoError(t, store.Delete(ctx, "bucket", "dir/key"))
+	assert.NoError(t, store.Delete(ctx, "bucket", "dir/key"))
+	_, err = store.Load(ctx, "bucket", "dir/key")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalCheckpointStore(t *testing.T) {
+	dir := t.TempDir() + "/checkpoints"
+	testCheckpointStore(t, NewLocalCheckpointStore(dir))
+
+	// 不留下临时文件
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestObjectCheckpointStore(t *testing.T) {
+	backend := NewMemoryBackend()
+	store, err := NewObjectCheckpointStore(&Config{Backend: backend}, ".checkpoints/")
+	assert.NoError(t, err)
+	testCheckpointStore(t, store)
+
+	assert.NoError(t, store.Save(context.Background(), "bucket", "key", []byte("{}")))
+	_, err = backend.HeadObject(context.Background(), ".checkpoints/bucket/key.checkpoint.json")
+	assert.NoError(t, err)
+}
+
+func newCheckpointTestFile(t *testing.T, size int) (string, []byte) {
+	data := make([]byte, size)
+	rand.Read(data)
+	file := t.TempDir() + "/file"
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	return file, data
+}
+
+func TestUploader_Checkpoint(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory, partErr: newObsError(http.StatusBadRequest, "InvalidPart", "")}
+	store := NewLocalCheckpointStore(t.TempDir())
+	uploader, err := NewUploader(&Config{
+		Backend:            backend,
+		PartSize:           4,
+		UpConcurrency:      1,
+		MultipartThreshold: 1,
+		CheckpointStore:    store,
+	})
+	assert.NoError(t, err)
+	file, data := newCheckpointTestFile(t, 2*partSize+10)
+
+	// 第 2 个分片失败，保留分片上传和断点
+	err = uploader.Upload(file, "key")
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+	assert.Equal(t, 0, backend.aborts)
+
+	raw, err := store.Load(context.Background(), "", "key")
+	assert.NoError(t, err)
+	cp := &uploadCheckpoint{}
+	assert.NoError(t, json.Unmarshal(raw, cp))
+	assert.Equal(t, file, cp.File)
+	assert.Equal(t, int64(2*partSize+10), cp.Size)
+	assert.Len(t, cp.Parts, 1)
+	assert.Equal(t, 1, cp.Parts[0].PartNumber)
+
+	// 续传时只上传未完成的分片
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key"))
+	assert.Equal(t, 1, backend.initiates)
+	assert.Equal(t, 2, backend.parts)
+	assert.Equal(t, data, readObject(t, memory, "key"))
+	_, err = store.Load(context.Background(), "", "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestUploader_NoCheckpoint(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	backend, uploader := newListingUploader(t, nil)
+	file, data := newCheckpointTestFile(t, 2*partSize+10)
+
+	// 没有设置断点存储时上传失败即取消分片上传，不写断点文件
+	err := uploader.Upload(file, "key")
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+	assert.Equal(t, 1, backend.aborts)
+	uploads, err := backend.ListMultipartUploads(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Empty(t, uploads)
+	entries, err := os.ReadDir(filepath.Dir(file))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// 再次上传时重新上传所有分片
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key"))
+	assert.Equal(t, 2, backend.initiates)
+	assert.Equal(t, 3, backend.parts)
+	assert.Equal(t, data, readObject(t, backend.Backend, "key"))
+}
+
+func TestUploader_CheckpointBesideFile(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory, partErr: newObsError(http.StatusBadRequest, "InvalidPart", "")}
+	uploader, err := NewUploader(&Config{Backend: backend, PartSize: 4, UpConcurrency: 1, MultipartThreshold: 1, CheckpointBesideFile: true})
+	assert.NoError(t, err)
+	file, data := newCheckpointTestFile(t, 2*partSize+10)
+
+	// 断点保存在源文件旁
+	err = uploader.Upload(file, "key")
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+	assert.Equal(t, 0, backend.aborts)
+	_, err = os.Stat(file + ".uploadfile_record")
+	assert.NoError(t, err)
+
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key"))
+	assert.Equal(t, 1, backend.initiates)
+	assert.Equal(t, 2, backend.parts)
+	assert.Equal(t, data, readObject(t, memory, "key"))
+	_, err = os.Stat(file + ".uploadfile_record")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploader_CheckpointInvalidated(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory, partErr: newObsError(http.StatusBadRequest, "InvalidPart", "")}
+	store := NewLocalCheckpointStore(t.TempDir())
+	uploader, err := NewUploader(&Config{
+		Backend:            backend,
+		PartSize:           4,
+		UpConcurrency:      1,
+		MultipartThreshold: 1,
+		CheckpointStore:    store,
+	})
+	assert.NoError(t, err)
+	file, _ := newCheckpointTestFile(t, 2*partSize+10)
+	assert.Error(t, uploader.Upload(file, "key"))
+
+	// 源文件修改后重新上传
+	data := make([]byte, 2*partSize+10)
+	rand.Read(data)
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Hour)))
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key"))
+	assert.Equal(t, 2, backend.initiates)
+	assert.Equal(t, 3, backend.parts)
+	assert.Equal(t, data, readObject(t, memory, "key"))
+
+	// 断点中的分片上传已不存在时重新上传
+	backend.partErr = newObsError(http.StatusBadRequest, "InvalidPart", "")
+	assert.Error(t, uploader.Upload(file, "key2"))
+	raw, err := store.Load(context.Background(), "", "key2")
+	assert.NoError(t, err)
+	cp := &uploadCheckpoint{}
+	assert.NoError(t, json.Unmarshal(raw, cp))
+	assert.NoError(t, memory.AbortMultipartUpload(context.Background(), "key2", cp.UploadID))
+
+	backend.partErr = nil
+	assert.NoError(t, uploader.Upload(file, "key2"))
+	assert.Equal(t, 4, backend.initiates)
+	assert.Equal(t, data, readObject(t, memory, "key2"))
+}
+
+// 支持列举分片的 multipartBackend
+type listingBackend struct {
+	*multipartBackend
+	MultipartLister
+}
+
+func newListingUploader(t *testing.T, store CheckpointStore) (*listingBackend, *Uploader) {
+	memory := NewMemoryBackend()
+	backend := &listingBackend{
+		multipartBackend: &multipartBackend{Backend: memory, partErr: newObsError(http.StatusBadRequest, "InvalidPart", "")},
+		MultipartLister:  memory,
+	}
+	uploader, err := NewUploader(&Config{
+		Backend:            backend,
+		PartSize:           4,
+		UpConcurrency:      1,
+		MultipartThreshold: 1,
+		CheckpointStore:    store,
+	})
+	assert.NoError(t, err)
+	return backend, uploader
+}
+
+func TestUploader_CheckpointLost(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	store := NewLocalCheckpointStore(t.TempDir())
+	backend, uploader := newListingUploader(t, store)
+	file, data := newCheckpointTestFile(t, 2*partSize+10)
+	assert.Error(t, uploader.Upload(file, "key"))
+
+	// 断点丢失时从服务端列举已上传的分片续传
+	assert.NoError(t, store.Delete(context.Background(), "", "key"))
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key"))
+	assert.Equal(t, 1, backend.initiates)
+	assert.Equal(t, 2, backend.parts)
+	assert.Equal(t, data, readObject(t, backend.Backend, "key"))
+
+	// 断点丢失且源文件已修改时，服务端的分片与源文件不一致，重新上传
+	backend.partErr = newObsError(http.StatusBadRequest, "InvalidPart", "")
+	assert.Error(t, uploader.Upload(file, "key2"))
+	assert.NoError(t, store.Delete(context.Background(), "", "key2"))
+	rand.Read(data)
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key2"))
+	assert.Equal(t, 3, backend.initiates)
+	assert.Equal(t, 3, backend.parts)
+	assert.Equal(t, data, readObject(t, backend.Backend, "key2"))
+}
+
+func TestUploader_CheckpointReconcile(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	store := NewLocalCheckpointStore(t.TempDir())
+	backend, uploader := newListingUploader(t, store)
+	file, data := newCheckpointTestFile(t, 2*partSize+10)
+	assert.Error(t, uploader.Upload(file, "key"))
+
+	// 分片已上传但未记录到断点，校验与源文件一致后沿用
+	raw, err := store.Load(context.Background(), "", "key")
+	assert.NoError(t, err)
+	cp := &uploadCheckpoint{}
+	assert.NoError(t, json.Unmarshal(raw, cp))
+	assert.Len(t, cp.Parts, 1)
+	cp.Parts = nil
+	raw, err = json.Marshal(cp)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save(context.Background(), "", "key", raw))
+
+	backend.partErr = nil
+	backend.parts = 0
+	assert.NoError(t, uploader.Upload(file, "key"))
+	assert.Equal(t, 1, backend.initiates)
+	assert.Equal(t, 2, backend.parts)
+	assert.Equal(t, data, readObject(t, backend.Backend, "key"))
+}
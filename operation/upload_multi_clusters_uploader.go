@@ -0,0 +1,57 @@
+package operation
+
+import (
+	"context"
+	"io"
+)
+
+type multiClustersUploader struct {
+	config    *MultiClustersConfig
+	uploaders []clusterUploader
+}
+
+func newMultiClustersUploader(c *MultiClustersConfig) (*multiClustersUploader, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	uploaders := make([]clusterUploader, len(c.Clusters))
+	for i, cluster := range c.Clusters {
+		uploader, err := newClusterUploader(cluster.Config)
+		if err != nil {
+			return nil, err
+		}
+		uploaders[i] = uploader
+	}
+	return &multiClustersUploader{config: c, uploaders: uploaders}, nil
+}
+
+func (p *multiClustersUploader) uploadData(ctx context.Context, data []byte, key string) error {
+	index, err := p.config.forKey(key)
+	if err != nil {
+		return err
+	}
+	return p.uploaders[index].uploadData(ctx, data, key)
+}
+
+func (p *multiClustersUploader) upload(ctx context.Context, file string, key string) error {
+	index, err := p.config.forKey(key)
+	if err != nil {
+		return err
+	}
+	return p.uploaders[index].upload(ctx, file, key)
+}
+
+func (p *multiClustersUploader) uploadReader(ctx context.Context, r io.Reader, key string) error {
+	index, err := p.config.forKey(key)
+	if err != nil {
+		return err
+	}
+	return p.uploaders[index].uploadReader(ctx, r, key)
+}
+
+func (p *multiClustersUploader) wait() {
+	for _, uploader := range p.uploaders {
+		uploader.wait()
+	}
+}
@@ -0,0 +1,343 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 多写一致性策略
+const (
+	// ReplicationAll 所有目标都写入成功才算成功
+	ReplicationAll = "all"
+	// ReplicationQuorum 超过半数的目标写入成功即算成功
+	ReplicationQuorum = "quorum"
+	// ReplicationPrimary 主目标同步写入成功即算成功，其余目标在后台异步写入
+	ReplicationPrimary = "primary"
+)
+
+// 异步写入单个目标的默认超时时间
+const defaultAsyncTimeout = 30 * time.Minute
+
+// ReplicationConfig 多写配置，见 Config.Replication。Config 本身为主目标。
+// UploadReader 的数据先暂存在临时文件中，各目标分别读取，慢的目标不阻塞其余目标
+type ReplicationConfig struct {
+	// Targets 主目标之外的写入目标
+	Targets []*Config
+	// Policy 一致性策略，可选 all（默认）、quorum、primary
+	Policy string
+	// Callback 每个目标写入完成后的回调，包括 primary 策略下的异步写入，可能被并发调用，可为空
+	Callback func(key string, result *TargetResult)
+	// AsyncTimeout primary 策略下异步写入单个目标的超时时间，异步写入不随调用方的 ctx 取消，默认 30 分钟
+	AsyncTimeout time.Duration
+}
+
+// TargetResult 单个写入目标的结果，见 ReplicationConfig.Callback 和 Uploader.UploadReplicated
+type TargetResult struct {
+	// Target 写入目标的配置
+	Target *Config
+	// Err 写入错误，成功时为 nil
+	Err error
+	// Async 是否为异步写入，异步写入的 Err 在 Uploader.Wait 返回后才是最终结果
+	Async bool
+}
+
+type replicationResultsKey struct{}
+
+// 多写的结果在内部随上下文传回调用方
+func withReplicationResults(ctx context.Context, results *[]*TargetResult) context.Context {
+	return context.WithValue(ctx, replicationResultsKey{}, results)
+}
+
+func publishResults(ctx context.Context, results []*TargetResult) {
+	if out, ok := ctx.Value(replicationResultsKey{}).(*[]*TargetResult); ok {
+		*out = results
+	}
+}
+
+// ReplicationError 多写未满足一致性策略
+type ReplicationError struct {
+	Policy    string
+	Succeeded int
+	Total     int
+	// Err 第一个失败目标的错误
+	Err error
+	// Results 已完成的各个目标的结果，primary 策略下主目标失败时只有主目标
+	Results []*TargetResult
+}
+
+func (e *ReplicationError) Error() string {
+	return fmt.Sprintf("replicated upload does not satisfy policy %s: %d of %d targets succeeded: %v", e.Policy, e.Succeeded, e.Total, e.Err)
+}
+
+func (e *ReplicationError) Unwrap() error {
+	return e.Err
+}
+
+// 多写上传，将每个对象同时写入多个存储空间或集群
+type replicatedUploader struct {
+	policy       string
+	targets      []*Config
+	uploaders    []*singleClusterUploader
+	callback     func(key string, result *TargetResult)
+	asyncTimeout time.Duration
+	async        sync.WaitGroup
+}
+
+func newReplicatedUploader(c *Config) (*replicatedUploader, error) {
+	r := c.Replication
+	if len(r.Targets) == 0 {
+		return nil, fmt.Errorf("no replication target configured")
+	}
+	policy := r.Policy
+	switch policy {
+	case "":
+		policy = ReplicationAll
+	case ReplicationAll, ReplicationQuorum, ReplicationPrimary:
+	default:
+		return nil, fmt.Errorf("unknown replication policy %q", r.Policy)
+	}
+
+	targets := append([]*Config{c}, r.Targets...)
+	uploaders := make([]*singleClusterUploader, len(targets))
+	for i, target := range targets {
+		uploader, err := newSingleClusterUploader(target)
+		if err != nil {
+			return nil, err
+		}
+		uploaders[i] = uploader
+	}
+	asyncTimeout := r.AsyncTimeout
+	if asyncTimeout <= 0 {
+		asyncTimeout = defaultAsyncTimeout
+	}
+	return &replicatedUploader{policy: policy, targets: targets, uploaders: uploaders, callback: r.Callback, asyncTimeout: asyncTimeout}, nil
+}
+
+// primary 策略下返回后 data 仍会被异步读取，调用方不应修改
+func (p *replicatedUploader) uploadData(ctx context.Context, data []byte, key string) error {
+	return p.replicate(ctx, key, func(ctx context.Context, i int) error {
+		return p.uploaders[i].uploadData(ctx, data, key)
+	}, nil)
+}
+
+// primary 策略下返回后文件仍会被异步读取
+func (p *replicatedUploader) upload(ctx context.Context, file string, key string) error {
+	return p.replicate(ctx, key, func(ctx context.Context, i int) error {
+		return p.uploaders[i].upload(ctx, file, key)
+	}, nil)
+}
+
+// 数据只能读取一次，边读取边写入临时文件，各目标分别从临时文件中读取。
+// primary 策略下主目标读完数据后返回，其余目标在后台继续读取，所有目标写入完成后删除临时文件
+func (p *replicatedUploader) uploadReader(ctx context.Context, r io.Reader, key string) error {
+	s, err := newSpool()
+	if err != nil {
+		return err
+	}
+	go s.fill(r)
+	return p.replicate(ctx, key, func(ctx context.Context, i int) error {
+		sr, stop := s.reader(ctx)
+		defer stop()
+		return p.uploaders[i].uploadReader(ctx, sr, key)
+	}, s.close)
+}
+
+// 多写流式上传时暂存数据的临时文件，由 fill 写入，每个目标各自从头读取，读到已写入的末尾时等待
+type spool struct {
+	f    *os.File
+	mu   sync.Mutex
+	cond *sync.Cond
+	size int64
+	// err 写入结束的原因，读完已写入的数据后返回给读取方，读到结尾时为 io.EOF
+	err    error
+	closed bool
+}
+
+func newSpool() (*spool, error) {
+	f, err := os.CreateTemp("", "obs-replicate-")
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{f: f}
+	s.cond = sync.NewCond(&s.mu)
+	return s, nil
+}
+
+// 把 r 的数据写入临时文件，读到结尾、出错或临时文件关闭后不再读取 r
+func (s *spool) fill(r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := s.f.Write(buf[:n]); werr != nil {
+				n, err = 0, werr
+			}
+		}
+
+		s.mu.Lock()
+		s.size += int64(n)
+		if err != nil {
+			s.err = err
+		}
+		done := s.err != nil || s.closed
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// 所有目标写入完成后关闭并删除临时文件，正在等待的读取方返回 io.ErrClosedPipe
+func (s *spool) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+// 从头读取临时文件的读取方，ctx 取消时等待中的 Read 返回 ctx 的错误，用完后调用 stop
+func (s *spool) reader(ctx context.Context) (io.Reader, func()) {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	return &spoolReader{s: s, ctx: ctx}, func() { close(stop) }
+}
+
+type spoolReader struct {
+	s   *spool
+	ctx context.Context
+	off int64
+}
+
+func (r *spoolReader) Read(p []byte) (int, error) {
+	s := r.s
+	s.mu.Lock()
+	for r.off >= s.size && s.err == nil && !s.closed && r.ctx.Err() == nil {
+		s.cond.Wait()
+	}
+	size, err, closed := s.size, s.err, s.closed
+	s.mu.Unlock()
+
+	switch {
+	case closed:
+		return 0, io.ErrClosedPipe
+	case r.off < size:
+		if remain := size - r.off; int64(len(p)) > remain {
+			p = p[:remain]
+		}
+		n, err := s.f.ReadAt(p, r.off)
+		r.off += int64(n)
+		return n, err
+	case err != nil:
+		return 0, err
+	}
+	return 0, r.ctx.Err()
+}
+
+func (p *replicatedUploader) wait() {
+	p.async.Wait()
+}
+
+// 按一致性策略写入所有目标，所有目标（包括异步写入的目标）写入完成后调用 done，可为空
+func (p *replicatedUploader) replicate(ctx context.Context, key string, upload func(ctx context.Context, i int) error, done func()) error {
+	if done == nil {
+		done = func() {}
+	}
+	results := make([]*TargetResult, len(p.uploaders))
+	for i, target := range p.targets {
+		results[i] = &TargetResult{Target: target}
+	}
+
+	if p.policy == ReplicationPrimary {
+		// 主目标失败时不再写入其余目标
+		results[0].Err = upload(ctx, 0)
+		p.report(key, results[0])
+		if results[0].Err != nil {
+			done()
+			publishResults(ctx, results[:1])
+			return p.check(results[:1])
+		}
+		// 异步写入保留 ctx 中的值（如 span），但不随 ctx 取消，以 asyncTimeout 为限
+		pending := int32(len(results) - 1)
+		for i := 1; i < len(results); i++ {
+			results[i].Async = true
+			p.async.Add(1)
+			go func(i int) {
+				defer p.async.Done()
+				asyncCtx, cancel := context.WithTimeout(detachedContext{ctx}, p.asyncTimeout)
+				results[i].Err = upload(asyncCtx, i)
+				cancel()
+				p.report(key, results[i])
+				if atomic.AddInt32(&pending, -1) == 0 {
+					done()
+				}
+			}(i)
+		}
+		publishResults(ctx, results)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].Err = upload(ctx, i)
+			p.report(key, results[i])
+		}(i)
+	}
+	wg.Wait()
+	done()
+	publishResults(ctx, results)
+	return p.check(results)
+}
+
+func (p *replicatedUploader) report(key string, result *TargetResult) {
+	if p.callback != nil {
+		p.callback(key, result)
+	}
+}
+
+// 成功的目标数不满足一致性策略时返回 ReplicationError
+func (p *replicatedUploader) check(results []*TargetResult) error {
+	var (
+		succeeded int
+		firstErr  error
+	)
+	for _, result := range results {
+		if result.Err == nil {
+			succeeded++
+		} else if firstErr == nil {
+			firstErr = result.Err
+		}
+	}
+
+	var ok bool
+	switch p.policy {
+	case ReplicationAll:
+		ok = succeeded == len(p.uploaders)
+	case ReplicationQuorum:
+		ok = succeeded >= len(p.uploaders)/2+1
+	case ReplicationPrimary:
+		ok = results[0].Err == nil
+	}
+	if ok {
+		return nil
+	}
+	return &ReplicationError{Policy: p.policy, Succeeded: succeeded, Total: len(p.uploaders), Err: firstErr, Results: results}
+}
@@ -0,0 +1,321 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 上传时返回指定错误的存储后端
+type failingPutBackend struct {
+	Backend
+	err error
+}
+
+func (b *failingPutBackend) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	return b.err
+}
+
+func (b *failingPutBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (string, error) {
+	return "", b.err
+}
+
+// 上传在 release 关闭前阻塞的存储后端，started 在开始上传时收到通知
+type blockingPutBackend struct {
+	Backend
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingPutBackend() *blockingPutBackend {
+	return &blockingPutBackend{Backend: NewMemoryBackend(), started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (b *blockingPutBackend) block(ctx context.Context) error {
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *blockingPutBackend) PutObject(ctx context.Context, key string, body io.Reader, size int64, opts *PutOptions) error {
+	if err := b.block(ctx); err != nil {
+		return err
+	}
+	return b.Backend.PutObject(ctx, key, body, size, opts)
+}
+
+func (b *blockingPutBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (string, error) {
+	if err := b.block(ctx); err != nil {
+		return "", err
+	}
+	return b.Backend.UploadPart(ctx, key, uploadID, partNumber, body, size, opts)
+}
+
+// 第一个目标为主目标，failed 表示对应的目标写入失败
+func newReplicatedUploaderTest(t *testing.T, replication *ReplicationConfig, failed ...bool) (*Uploader, []*MemoryBackend) {
+	var (
+		targets  []*Config
+		backends []*MemoryBackend
+	)
+	for _, f := range failed {
+		backend := NewMemoryBackend()
+		backends = append(backends, backend)
+		if f {
+			targets = append(targets, &Config{Backend: &failingPutBackend{Backend: backend, err: newObsError(http.StatusServiceUnavailable, "ServiceUnavailable", "")}, RetryPolicy: fastRetryPolicy(1)})
+		} else {
+			targets = append(targets, &Config{Backend: backend})
+		}
+	}
+	replication.Targets = targets[1:]
+	targets[0].Replication = replication
+	uploader, err := NewUploader(targets[0])
+	assert.NoError(t, err)
+	return uploader, backends
+}
+
+func TestReplicatedUploader_All(t *testing.T) {
+	uploader, backends := newReplicatedUploaderTest(t, &ReplicationConfig{}, false, false)
+	assert.NoError(t, uploader.UploadData([]byte("data"), "key"))
+	for _, backend := range backends {
+		assert.Equal(t, "data", string(readObject(t, backend, "key")))
+	}
+
+	uploader, _ = newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationAll}, false, true)
+	err := uploader.UploadData([]byte("data"), "key")
+	var replicationErr *ReplicationError
+	assert.True(t, errors.As(err, &replicationErr))
+	assert.Equal(t, 1, replicationErr.Succeeded)
+	assert.Equal(t, http.StatusServiceUnavailable, statusCodeOf(err))
+	assert.Len(t, replicationErr.Results, 2)
+	assert.NoError(t, replicationErr.Results[0].Err)
+	assert.Error(t, replicationErr.Results[1].Err)
+}
+
+func TestReplicatedUploader_Quorum(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		results []*TargetResult
+	)
+	callback := func(key string, result *TargetResult) {
+		mu.Lock()
+		results = append(results, result)
+		mu.Unlock()
+	}
+	uploader, _ := newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationQuorum, Callback: callback}, false, true, false)
+	assert.NoError(t, uploader.UploadData([]byte("data"), "key"))
+	// 满足策略时通过回调获取失败的目标
+	assert.Len(t, results, 3)
+	failures := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failures++
+		}
+	}
+	assert.Equal(t, 1, failures)
+
+	uploader, _ = newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationQuorum}, false, true, true)
+	assert.Error(t, uploader.UploadData([]byte("data"), "key"))
+}
+
+func TestReplicatedUploader_Primary(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		async []*TargetResult
+	)
+	uploader, backends := newReplicatedUploaderTest(t, &ReplicationConfig{
+		Policy: ReplicationPrimary,
+		Callback: func(key string, result *TargetResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Async {
+				async = append(async, result)
+			}
+		},
+	}, false, false, true)
+	assert.NoError(t, uploader.UploadData([]byte("data"), "key"))
+
+	uploader.Wait()
+	assert.Len(t, async, 2)
+	_, err := backends[1].HeadObject(context.Background(), "key")
+	assert.NoError(t, err)
+
+	// 主目标失败时不写入其余目标
+	uploader, backends = newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationPrimary}, true, false)
+	err = uploader.UploadData([]byte("data"), "key")
+	var replicationErr *ReplicationError
+	assert.True(t, errors.As(err, &replicationErr))
+	assert.Len(t, replicationErr.Results, 1)
+	uploader.Wait()
+	_, err = backends[1].HeadObject(context.Background(), "key")
+	assert.Equal(t, http.StatusNotFound, statusCodeOf(err))
+}
+
+func TestReplicatedUploader_Results(t *testing.T) {
+	ctx := context.Background()
+	uploader, _ := newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationQuorum}, false, true, false)
+	// 不设置回调也能取得满足策略时失败的目标
+	results, err := uploader.UploadDataReplicated(ctx, []byte("data"), "key")
+	assert.NoError(t, err)
+	if assert.Len(t, results, 3) {
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, http.StatusServiceUnavailable, statusCodeOf(results[1].Err))
+		assert.NoError(t, results[2].Err)
+	}
+	results, err = uploader.UploadReaderReplicated(ctx, &streamReader{bytes.NewReader([]byte("data"))}, "key")
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	// 异步写入的结果在 Wait 之后读取
+	uploader, _ = newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationPrimary}, false, true)
+	file, _ := newCheckpointTestFile(t, 10)
+	results, err = uploader.UploadReplicated(ctx, file, "key")
+	assert.NoError(t, err)
+	uploader.Wait()
+	if assert.Len(t, results, 2) {
+		assert.False(t, results[0].Async)
+		assert.True(t, results[1].Async)
+		assert.Error(t, results[1].Err)
+	}
+
+	// 失败时结果与 ReplicationError 中的相同
+	uploader, _ = newReplicatedUploaderTest(t, &ReplicationConfig{}, false, true)
+	results, err = uploader.UploadDataReplicated(ctx, []byte("data"), "key")
+	var replicationErr *ReplicationError
+	assert.True(t, errors.As(err, &replicationErr))
+	assert.Equal(t, replicationErr.Results, results)
+
+	// 没有多写时结果为空
+	single, err := NewUploader(&Config{Backend: NewMemoryBackend()})
+	assert.NoError(t, err)
+	results, err = single.UploadDataReplicated(ctx, []byte("data"), "key")
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestReplicatedUploader_UploadReader(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	data := bytes.Repeat([]byte("0123456789"), partSize/5)
+
+	// 流式上传同时写入所有目标
+	uploader, backends := newReplicatedUploaderTest(t, &ReplicationConfig{}, false, false)
+	assert.NoError(t, uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "key"))
+	w := uploader.NewWriter("writer")
+	_, err := w.Write(data[:10])
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	for _, backend := range backends {
+		assert.Equal(t, data, readObject(t, backend, "key"))
+		assert.Equal(t, data[:10], readObject(t, backend, "writer"))
+	}
+
+	// 失败的目标不阻塞其余目标
+	uploader, backends = newReplicatedUploaderTest(t, &ReplicationConfig{Policy: ReplicationPrimary}, false, true)
+	assert.NoError(t, uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "key"))
+	assert.Equal(t, data, readObject(t, backends[0], "key"))
+
+	uploader, _ = newReplicatedUploaderTest(t, &ReplicationConfig{}, false, true)
+	assert.Error(t, uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "key"))
+}
+
+func TestReplicatedUploader_UploadReaderStalled(t *testing.T) {
+	// 临时文件写在测试目录中，检查写入完成后被删除
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	primary, stalled := NewMemoryBackend(), newBlockingPutBackend()
+	uploader, err := NewUploader(&Config{Backend: primary, Replication: &ReplicationConfig{
+		Targets: []*Config{{Backend: stalled, PartSize: 4, UpConcurrency: 1}},
+	}})
+	assert.NoError(t, err)
+
+	// 阻塞的目标停止读取后不影响主目标写入
+	data := make([]byte, 5*4*1024*1024)
+	rand.Read(data)
+	done := make(chan error, 1)
+	go func() {
+		done <- uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "key")
+	}()
+	<-stalled.started
+	assert.Eventually(t, func() bool {
+		_, err := primary.HeadObject(context.Background(), "key")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, data, readObject(t, primary, "key"))
+
+	close(stalled.release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, data, readObject(t, stalled.Backend, "key"))
+	entries, err := os.ReadDir(tmp)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReplicatedUploader_AsyncContext(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	stalled := newBlockingPutBackend()
+	uploader, err := NewUploader(&Config{Backend: NewMemoryBackend(), Replication: &ReplicationConfig{
+		Policy:       ReplicationPrimary,
+		Targets:      []*Config{{Backend: stalled, RetryPolicy: fastRetryPolicy(1)}},
+		AsyncTimeout: 50 * time.Millisecond,
+	}})
+	assert.NoError(t, err)
+
+	// 调用方的 ctx 在返回后取消，不影响异步写入
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := uploader.UploadReaderReplicated(ctx, &streamReader{bytes.NewReader([]byte("data"))}, "key")
+	assert.NoError(t, err)
+	cancel()
+	<-stalled.started
+	uploader.Wait()
+	if assert.Len(t, results, 2) {
+		// 异步写入以 AsyncTimeout 为限
+		assert.ErrorIs(t, results[1].Err, context.DeadlineExceeded)
+	}
+	entries, err := os.ReadDir(tmp)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// 未超时的异步写入在调用方的 ctx 取消后仍然完成
+	uploader, err = NewUploader(&Config{Backend: NewMemoryBackend(), Replication: &ReplicationConfig{
+		Policy:  ReplicationPrimary,
+		Targets: []*Config{{Backend: stalled}},
+	}})
+	assert.NoError(t, err)
+	stalled.release = make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
+	results, err = uploader.UploadDataReplicated(ctx, []byte("data"), "key")
+	assert.NoError(t, err)
+	cancel()
+	<-stalled.started
+	close(stalled.release)
+	uploader.Wait()
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, "data", string(readObject(t, stalled.Backend, "key")))
+}
+
+func TestReplicatedUploader_MultiClusters(t *testing.T) {
+	primary, replica := NewMemoryBackend(), NewMemoryBackend()
+	uploader, err := NewMultiClustersUploader(&MultiClustersConfig{Clusters: []*ClusterConfig{
+		{Config: &Config{Backend: primary, Replication: &ReplicationConfig{Targets: []*Config{{Backend: replica}}}}, Prefixes: []string{""}},
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, uploader.UploadData([]byte("data"), "key"))
+	assert.Equal(t, "data", string(readObject(t, replica, "key")))
+}
@@ -2,101 +2,392 @@ package operation
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
+	"context"
+	"io"
 	"os"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 
-	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"golang.org/x/sync/errgroup"
 )
 
+// 默认超过 50 MiB 的文件使用分片上传
+const defaultMultipartThreshold = 50 * 1024 * 1024
+
 type singleClusterUploader struct {
-	bucket        string
-	partSize      int64
-	upConcurrency int
-	client        *obs.ObsClient
+	bucket               string
+	partSize             int64
+	multipartThreshold   int64
+	upConcurrency        int
+	checksum             string
+	backend              Backend
+	checkpoints          CheckpointStore
+	checkpointBesideFile bool
+	retry                *RetryPolicy
+	telemetry            *telemetry
 }
 
-func newSingleClusterUploader(c *Config) *singleClusterUploader {
-	obsClient, err := obs.New(c.Ak, c.Sk, c.EndPoint)
-
+func newSingleClusterUploader(c *Config) (*singleClusterUploader, error) {
+	backend, err := newBackend(c)
 	if err != nil {
-		fmt.Printf("Create obsClient error, errMsg: %s\n", err.Error())
+		return nil, err
+	}
+	if err = checkChecksumAlgorithm(c.Checksum); err != nil {
+		return nil, err
 	}
 
 	partSize := c.PartSize * 1024 * 1024
 	if partSize < 4*1024*1024 {
 		partSize = 4 * 1024 * 1024
 	}
-	return &singleClusterUploader{
-		bucket:        c.Bucket,
-		partSize:      partSize,
-		client:        obsClient,
-		upConcurrency: c.UpConcurrency,
+	threshold := c.MultipartThreshold * 1024 * 1024
+	if threshold <= 0 {
+		threshold = defaultMultipartThreshold
+	}
+	upConcurrency := c.UpConcurrency
+	if upConcurrency <= 0 {
+		upConcurrency = 20
 	}
+	return &singleClusterUploader{
+		bucket:               c.Bucket,
+		partSize:             partSize,
+		multipartThreshold:   threshold,
+		backend:              backend,
+		checkpoints:          c.CheckpointStore,
+		checkpointBesideFile: c.CheckpointBesideFile,
+		upConcurrency:        upConcurrency,
+		checksum:             c.Checksum,
+		retry:                newRetryPolicy(c.RetryPolicy),
+		telemetry:            newTelemetry(c),
+	}, nil
 }
 
-func (p *singleClusterUploader) uploadData(data []byte, key string) error {
-	if p.client == nil {
-		return errors.New("obsclient is nil")
+func (p *singleClusterUploader) uploadData(ctx context.Context, data []byte, key string) (err error) {
+	if p.backend == nil {
+		return ErrClientNotInitialized
 	}
 
-	t := time.Now()
+	key = strings.TrimPrefix(key, "/")
+	ctx, op := p.telemetry.start(ctx, OpUploadData, "key", key, "size", len(data))
+	ctx, progress := startProgress(ctx, OpUploadData, p.bucket, key, int64(len(data)))
 	defer func() {
-		fmt.Printf("上传对象总共花了%d\n", time.Since(t))
+		op.end(int64(len(data)), err)
+		progress.finish(err)
 	}()
-	key = strings.TrimPrefix(key, "/")
-	input := &obs.PutObjectInput{}
-	input.Bucket = p.bucket
-	input.Key = key
-	input.Body = bytes.NewReader(data)
-	_, err := p.client.PutObject(input)
 
-	return err
+	return p.putObject(ctx, op.log, key, bytes.NewReader(data), int64(len(data)))
 }
 
-func (p *singleClusterUploader) upload(file string, key string) (err error) {
-	if p.client == nil {
-		return errors.New("obsclient is nil")
+func (p *singleClusterUploader) upload(ctx context.Context, file string, key string) (err error) {
+	if p.backend == nil {
+		return ErrClientNotInitialized
 	}
 
-	t := time.Now()
+	key = strings.TrimPrefix(key, "/")
+	ctx, op := p.telemetry.start(ctx, OpUpload, "key", key, "file", file)
+	var size int64
 	defer func() {
-		fmt.Printf("上传对象总共花了%d\n", time.Since(t))
+		op.end(size, err)
 	}()
-	key = strings.TrimPrefix(key, "/")
 
 	f, err := os.Open(file)
 	if err != nil {
-		fmt.Printf("open file failed: %d\n", err)
 		return err
 	}
 	defer f.Close()
 
 	fInfo, err := f.Stat()
 	if err != nil {
-		fmt.Printf("get file stat failed: %v\n", err)
 		return err
 	}
 
-	if fInfo.Size() <= 50*1024*1024 {
+	size = fInfo.Size()
+	op.span.SetAttributes(Attribute{Key: "size", Value: size})
+	ctx, progress := startProgress(ctx, OpUpload, p.bucket, key, size)
+	defer func() {
+		progress.finish(err)
+	}()
+	if size <= p.multipartThreshold {
 		// 小对象
-		input := &obs.PutFileInput{}
-		input.Bucket = p.bucket
-		input.Key = key
-		input.SourceFile = file
-		_, err = p.client.PutFile(input)
+		return p.putObject(ctx, op.log, key, io.NewSectionReader(f, 0, size), size)
+	}
+	checkpoints := p.checkpoints
+	if checkpoints == nil && p.checkpointBesideFile {
+		checkpoints = newFileCheckpointStore(file)
+	}
+	if checkpoints != nil {
+		return p.uploadWithCheckpoint(ctx, op.log, checkpoints, file, f, fInfo, key)
+	}
+	opts, err := p.multipartOptions(f, size)
+	if err != nil {
+		return err
+	}
+	return p.multipart(ctx, op.log, key, opts, func(ctx context.Context, uploadID string) ([]Part, error) {
+		return p.uploadFileParts(ctx, op.log, f, size, key, uploadID, nil, nil)
+	})
+}
+
+// 单个目标没有异步写入
+func (p *singleClusterUploader) wait() {}
+
+// 流式上传长度未知的数据，不超过一个分片时直接上传，否则边读取边并发上传分片
+func (p *singleClusterUploader) uploadReader(ctx context.Context, r io.Reader, key string) (err error) {
+	if p.backend == nil {
+		return ErrClientNotInitialized
+	}
+
+	key = strings.TrimPrefix(key, "/")
+	ctx, op := p.telemetry.start(ctx, OpUploadReader, "key", key)
+	ctx, progress := startProgress(ctx, OpUploadReader, p.bucket, key, -1)
+	var size int64
+	defer func() {
+		op.end(size, err)
+		progress.finish(err)
+	}()
+
+	// 多读一个字节判断数据是否超过一个分片
+	first := make([]byte, p.partSize+1)
+	n, err := io.ReadFull(r, first)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		size = int64(n)
+		return p.putObject(ctx, op.log, key, bytes.NewReader(first[:n]), int64(n))
+	}
+	if err != nil {
+		return err
+	}
+
+	// 长度未知的数据无法在初始化分片上传前计算整个对象的校验值，只校验每个分片
+	r = io.MultiReader(bytes.NewReader(first[p.partSize:]), r)
+	return p.multipart(ctx, op.log, key, nil, func(ctx context.Context, uploadID string) ([]Part, error) {
+		parts, n, err := p.uploadStreamParts(ctx, op.log, key, uploadID, first[:p.partSize], r)
+		size = n
+		return parts, err
+	})
+}
+
+// 边读取边并发上传分片，最多同时在内存中保留 upConcurrency 个分片，first 为已读取的第一个分片
+func (p *singleClusterUploader) uploadStreamParts(ctx context.Context, log *fieldLogger, key, uploadID string, first []byte, r io.Reader) ([]Part, int64, error) {
+	var (
+		group, groupCtx = errgroup.WithContext(ctx)
+		buffers         = make(chan []byte, p.upConcurrency)
+		allocated       = 1
+		mu              sync.Mutex
+		parts           []Part
+		size            int64
+		readErr         error
+	)
+	// 优先复用已上传完的分片的内存，未达到并发数时分配新的内存
+	acquire := func() ([]byte, error) {
+		select {
+		case buf := <-buffers:
+			return buf, nil
+		default:
+		}
+		if allocated < p.upConcurrency {
+			allocated++
+			return make([]byte, p.partSize), nil
+		}
+		select {
+		case buf := <-buffers:
+			return buf, nil
+		case <-groupCtx.Done():
+			return nil, groupCtx.Err()
+		}
+	}
+
+	data := first
+	for partNumber := 1; ; partNumber++ {
+		func(partNumber int, offset int64, data []byte) {
+			group.Go(func() error {
+				part, err := p.uploadPart(groupCtx, log, key, uploadID, partNumber, offset, bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				parts = append(parts, part)
+				mu.Unlock()
+				buffers <- data[:p.partSize]
+				return nil
+			})
+		}(partNumber, size, data)
+		size += int64(len(data))
+		if int64(len(data)) < p.partSize {
+			break
+		}
+
+		buf, err := acquire()
+		if err != nil {
+			// 有分片上传失败，错误由 group.Wait 返回
+			break
+		}
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			readErr = err
+			break
+		}
+		data = buf[:n]
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, size, err
+	}
+	if readErr != nil {
+		return nil, size, readErr
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	return parts, size, nil
+}
+
+// 开启校验时读取 body 计算 Content-MD5，withChecksum 时在元数据中保存整个对象的校验值，之后 body 回到开头
+func (p *singleClusterUploader) putOptions(body io.ReadSeeker, withChecksum bool) (*PutOptions, error) {
+	if p.checksum == "" {
+		return nil, nil
+	}
+	algorithm := ""
+	if withChecksum {
+		algorithm = p.checksum
+	}
+	contentMD5, checksum, err := computeChecksum(body, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	opts := &PutOptions{ContentMD5: contentMD5}
+	if withChecksum {
+		opts.Metadata = checksumMetadata(p.checksum, checksum)
+	}
+	return opts, nil
+}
+
+// 开启校验时计算整个文件的校验值，初始化分片上传时保存在元数据中
+func (p *singleClusterUploader) multipartOptions(f io.ReaderAt, size int64) (*PutOptions, error) {
+	if p.checksum == "" {
+		return nil, nil
+	}
+	_, checksum, err := computeChecksum(io.NewSectionReader(f, 0, size), p.checksum)
+	if err != nil {
+		return nil, err
+	}
+	return &PutOptions{Metadata: checksumMetadata(p.checksum, checksum)}, nil
+}
+
+// 按重试策略上传单个对象，每次重试前 body 回到开头
+func (p *singleClusterUploader) putObject(ctx context.Context, log *fieldLogger, key string, body io.ReadSeeker, size int64) error {
+	opts, err := p.putOptions(body, true)
+	if err != nil {
+		return err
+	}
+	return p.retry.do(ctx, log, func(ctx context.Context) error {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return trackBody(ctx, body, func(body io.Reader) error {
+			return p.backend.PutObject(ctx, key, body, size, opts)
+		})
+	})
+}
+
+// 使用 GoroutinePool 并发上传文件的各个分片，跳过 completed 中已完成的分片，
+// 每完成一个分片调用一次 onPart，返回按分片号排列的所有分片
+func (p *singleClusterUploader) uploadFileParts(ctx context.Context, log *fieldLogger, f io.ReaderAt, size int64, key, uploadID string, completed map[int]Part, onPart func(Part)) ([]Part, error) {
+	var (
+		partCount = int((size + p.partSize - 1) / p.partSize)
+		parts     = make([]Part, partCount)
+		pool      = NewGoroutinePool(p.upConcurrency)
+	)
+	spanFromContext(ctx).SetAttributes(Attribute{Key: "parts", Value: partCount})
+	var skipped int64
+	for i := 0; i < partCount; i++ {
+		offset := int64(i) * p.partSize
+		partSize := p.partSize
+		if partSize > size-offset {
+			partSize = size - offset
+		}
+		if part, ok := completed[i+1]; ok && part.Size == partSize {
+			parts[i] = part
+			skipped += partSize
+			continue
+		}
+
+		func(partNumber int, offset, partSize int64) {
+			pool.Go(func(ctx context.Context) (err error) {
+				part, err := p.uploadPart(ctx, log, key, uploadID, partNumber, offset, io.NewSectionReader(f, offset, partSize), partSize)
+				if err != nil {
+					return err
+				}
+				parts[partNumber-1] = part
+				if onPart != nil {
+					onPart(part)
+				}
+				return nil
+			})
+		}(i+1, offset, partSize)
+	}
+	// 续传时已完成的分片计入进度
+	progressFromContext(ctx).add(skipped)
+	if err := pool.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// 以 opts 初始化分片上传后由 upload 上传所有分片，成功时合并分片，任意分片失败时取消本次分片上传
+func (p *singleClusterUploader) multipart(ctx context.Context, log *fieldLogger, key string, opts *PutOptions, upload func(ctx context.Context, uploadID string) ([]Part, error)) error {
+	var uploadID string
+	err := p.retry.do(ctx, log, func(ctx context.Context) (err error) {
+		uploadID, err = p.backend.InitiateMultipartUpload(ctx, key, opts)
 		return
+	})
+	if err != nil {
+		return err
+	}
+
+	parts, err := upload(ctx, uploadID)
+	if err != nil {
+		// ctx 可能已被取消，使用新的上下文清理已上传的分片
+		if abortErr := p.backend.AbortMultipartUpload(context.Background(), key, uploadID); abortErr != nil {
+			log.warn("abort multipart upload failed", "upload_id", uploadID, "error", abortErr)
+		}
+		return err
 	}
+	spanFromContext(ctx).SetAttributes(Attribute{Key: "parts", Value: len(parts)})
+	return p.retry.do(ctx, log, func(ctx context.Context) error {
+		return p.backend.CompleteMultipartUpload(ctx, key, uploadID, parts)
+	})
+}
+
+// 上传一个分片，每次重试前 body 回到开头，offset 为分片在对象中的位置
+func (p *singleClusterUploader) uploadPart(ctx context.Context, log *fieldLogger, key, uploadID string, partNumber int, offset int64, body io.ReadSeeker, size int64) (part Part, err error) {
+	ctx, span := p.telemetry.span(ctx, "upload_part", "key", key, "part", partNumber, "offset", offset, "size", size)
+	defer func() {
+		endSpan(span, err)
+	}()
 
-	input := &obs.UploadFileInput{}
-	input.Bucket = p.bucket
-	input.Key = key
-	input.UploadFile = file
-	input.EnableCheckpoint = true
-	input.PartSize = p.partSize
-	input.TaskNum = p.upConcurrency
-	_, err = p.client.UploadFile(input)
-	return
+	opts, err := p.putOptions(body, false)
+	if err != nil {
+		return Part{}, err
+	}
+	var etag string
+	err = p.retry.do(ctx, log.with("part", partNumber), func(ctx context.Context) (err error) {
+		if _, err = body.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return trackBody(ctx, body, func(body io.Reader) (err error) {
+			etag, err = p.backend.UploadPart(ctx, key, uploadID, partNumber, body, size, opts)
+			return
+		})
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	progressFromContext(ctx).partCompleted(partNumber)
+	return Part{PartNumber: partNumber, ETag: etag, Size: size}, nil
 }
@@ -0,0 +1,143 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 记录分片上传调用的存储后端
+type multipartBackend struct {
+	Backend
+	partErr error
+
+	mu        sync.Mutex
+	initiates int
+	parts     int
+	aborts    int
+	inflight  int
+	maxFlight int
+}
+
+func (b *multipartBackend) InitiateMultipartUpload(ctx context.Context, key string, opts *PutOptions) (string, error) {
+	b.mu.Lock()
+	b.initiates++
+	b.mu.Unlock()
+	return b.Backend.InitiateMultipartUpload(ctx, key, opts)
+}
+
+func (b *multipartBackend) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.Reader, size int64, opts *PutOptions) (string, error) {
+	b.mu.Lock()
+	b.parts++
+	b.inflight++
+	if b.inflight > b.maxFlight {
+		b.maxFlight = b.inflight
+	}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.inflight--
+		b.mu.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond)
+	if b.partErr != nil && partNumber == 2 {
+		return "", b.partErr
+	}
+	return b.Backend.UploadPart(ctx, key, uploadID, partNumber, body, size, opts)
+}
+
+func (b *multipartBackend) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	b.mu.Lock()
+	b.aborts++
+	b.mu.Unlock()
+	return b.Backend.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+// 隐藏长度信息的 Reader
+type streamReader struct {
+	r io.Reader
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func readObject(t *testing.T, backend Backend, key string) []byte {
+	output, err := backend.GetObject(context.Background(), key, nil)
+	assert.NoError(t, err)
+	defer output.Body.Close()
+	data, err := io.ReadAll(output.Body)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestUploader_UploadReader(t *testing.T) {
+	const partSize = 4 * 1024 * 1024
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory}
+	uploader, err := NewUploader(&Config{Backend: backend, PartSize: 4, UpConcurrency: 2})
+	assert.NoError(t, err)
+
+	// 不超过一个分片时直接上传
+	for _, size := range []int{0, 100, partSize} {
+		data := make([]byte, size)
+		rand.Read(data)
+		err = uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "small")
+		assert.NoError(t, err)
+		assert.Equal(t, data, readObject(t, memory, "small"))
+	}
+	assert.Equal(t, 0, backend.initiates)
+
+	for _, size := range []int{partSize + 1, 5*partSize + 3} {
+		data := make([]byte, size)
+		rand.Read(data)
+		err = uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "/large")
+		assert.NoError(t, err)
+		assert.Equal(t, data, readObject(t, memory, "large"))
+	}
+	assert.Equal(t, 2, backend.initiates)
+	assert.LessOrEqual(t, backend.maxFlight, 2)
+}
+
+func TestUploader_UploadReaderError(t *testing.T) {
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory, partErr: newObsError(http.StatusBadRequest, "InvalidPart", "")}
+	uploader, err := NewUploader(&Config{Backend: backend, PartSize: 4, UpConcurrency: 2})
+	assert.NoError(t, err)
+
+	// 分片上传失败时取消分片上传
+	data := make([]byte, 5*4*1024*1024)
+	err = uploader.UploadReader(&streamReader{bytes.NewReader(data)}, "key")
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+	assert.Equal(t, 1, backend.aborts)
+
+	// 读取失败时取消分片上传
+	backend.partErr = nil
+	readErr := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(data), &errReader{err: readErr})
+	err = uploader.UploadReader(r, "key")
+	assert.ErrorIs(t, err, readErr)
+	assert.Equal(t, 2, backend.aborts)
+
+	_, err = memory.HeadObject(context.Background(), "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// 以 4 字节的分片经 upload 分片上传 data，用于检查后端的分片上传接口
+func uploadSmallParts(t *testing.T, backend Backend, data []byte, key string) error {
+	file := filepath.Join(t.TempDir(), "multipart")
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	uploader := &singleClusterUploader{partSize: 4, multipartThreshold: 1, upConcurrency: 2, backend: backend, retry: newRetryPolicy(nil), telemetry: newTelemetry(&Config{})}
+	return uploader.upload(context.Background(), file, key)
+}
@@ -0,0 +1,61 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrWriterAborted ObjectWriter 被 CloseWithError(nil) 中止
+var ErrWriterAborted = errors.New("object writer aborted")
+
+// ObjectWriter 流式写入对象，写满一个分片即开始并发上传，Close 时完成上传，
+// CloseWithError 时中止上传，不会留下对象或未完成的分片上传
+type ObjectWriter struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+// NewWriter 创建写入指定对象的 ObjectWriter
+func (p *Uploader) NewWriter(key string) *ObjectWriter {
+	return p.NewWriterContext(context.Background(), key)
+}
+
+// NewWriterContext 创建写入指定对象的 ObjectWriter，ctx 取消时中止上传，之后的 Write 返回错误
+func (p *Uploader) NewWriterContext(ctx context.Context, key string) *ObjectWriter {
+	pr, pw := io.Pipe()
+	w := &ObjectWriter{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		w.err = p.uploadReader(ctx, pr, key)
+		// 上传失败后 Write 返回上传的错误
+		pr.CloseWithError(w.err)
+	}()
+	return w
+}
+
+// Write 写入数据，上传失败后返回上传的错误
+func (w *ObjectWriter) Write(data []byte) (int, error) {
+	return w.pw.Write(data)
+}
+
+// Close 完成上传，返回上传的结果
+func (w *ObjectWriter) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+// CloseWithError 中止上传，err 为空时使用 ErrWriterAborted，上传已因其他错误失败时返回该错误
+func (w *ObjectWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = ErrWriterAborted
+	}
+	w.pw.CloseWithError(err)
+	<-w.done
+	if w.err == nil || errors.Is(w.err, err) {
+		return nil
+	}
+	return w.err
+}
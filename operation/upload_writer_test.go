@@ -0,0 +1,90 @@
+package operation
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectWriter(t *testing.T) {
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory}
+	uploader, err := NewUploader(&Config{Backend: backend, PartSize: 4, UpConcurrency: 2})
+	assert.NoError(t, err)
+
+	// 通过 gzip 写入
+	w := uploader.NewWriter("small.gz")
+	gz := gzip.NewWriter(w)
+	_, err = gz.Write([]byte("hello world"))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, w.Close())
+
+	r, err := gzip.NewReader(bytes.NewReader(readObject(t, memory, "small.gz")))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, 0, backend.initiates)
+
+	// 超过一个分片时使用分片上传
+	data = make([]byte, 3*4*1024*1024+5)
+	rand.Read(data)
+	w = uploader.NewWriterContext(context.Background(), "large")
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err = w.Write(data[i:end])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, data, readObject(t, memory, "large"))
+	assert.Equal(t, 1, backend.initiates)
+
+	// Close 之后不能再写入
+	_, err = w.Write([]byte("data"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestObjectWriter_CloseWithError(t *testing.T) {
+	memory := NewMemoryBackend()
+	backend := &multipartBackend{Backend: memory}
+	uploader, err := NewUploader(&Config{Backend: backend, PartSize: 4, UpConcurrency: 2})
+	assert.NoError(t, err)
+
+	// 中止时取消分片上传，不留下对象
+	w := uploader.NewWriter("key")
+	_, err = w.Write(make([]byte, 2*4*1024*1024))
+	assert.NoError(t, err)
+	assert.NoError(t, w.CloseWithError(errors.New("encoder failed")))
+	assert.Equal(t, 1, backend.aborts)
+	_, err = memory.HeadObject(context.Background(), "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// 小对象中止时不上传
+	w = uploader.NewWriter("key")
+	_, err = w.Write([]byte("data"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.CloseWithError(nil))
+	_, err = memory.HeadObject(context.Background(), "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// 上传失败后 Write 返回上传的错误
+	backend.partErr = newObsError(http.StatusBadRequest, "InvalidPart", "")
+	w = uploader.NewWriter("key")
+	err = nil
+	for err == nil {
+		_, err = w.Write(make([]byte, 1024*1024))
+	}
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(err))
+	assert.Equal(t, http.StatusBadRequest, statusCodeOf(w.Close()))
+}
@@ -1,7 +1,14 @@
 package operation
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	obs "github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
 )
@@ -26,9 +33,101 @@ func generateRange(offset, size int64) string {
 	if offset == -1 {
 		return fmt.Sprintf("bytes=-%d", size)
 	}
+	if size == -1 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
 	return fmt.Sprintf("bytes=%d-%d", offset, offset+size-1)
 }
 
 func checkObsClient(clent obs.ObsClient) {
 
 }
+
+// 获取错误对应的 HTTP 状态码，非 OBS 错误返回 0
+func statusCodeOf(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	var obsErr obs.ObsError
+	if errors.As(err, &obsErr) {
+		return obsErr.StatusCode
+	}
+	return 0
+}
+
+// 构造与 OBS 服务端返回一致的错误，供非 OBS 后端使用
+func newObsError(statusCode int, code, message string) error {
+	err := obs.ObsError{Code: code, Message: message}
+	err.StatusCode = statusCode
+	err.Status = fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+	return wrapError(err)
+}
+
+// 按照 OBS 列举对象的语义对 keys 进行过滤和分页
+// 返回本页的对象、公共前缀，以及下一页的 marker（为空表示已经列举完毕）
+func paginateKeys(keys []string, prefix, delimiter, marker string, limit int) (items []string, commonPrefixes []string, nextMarker string) {
+	sort.Strings(keys)
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+
+	var last string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			continue
+		}
+
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" && len(commonPrefixes) > 0 && commonPrefixes[len(commonPrefixes)-1] == commonPrefix {
+			last = key
+			continue
+		}
+		if len(items)+len(commonPrefixes) >= limit {
+			return items, commonPrefixes, last
+		}
+
+		if commonPrefix != "" {
+			commonPrefixes = append(commonPrefixes, commonPrefix)
+		} else {
+			items = append(items, key)
+		}
+		last = key
+	}
+	return items, commonPrefixes, ""
+}
+
+// 先写入同目录下的临时文件再重命名，进程退出时不会留下写了一半的文件
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// 从 offset 开始顺序写入 WriterAt
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}